@@ -0,0 +1,197 @@
+package affected
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	projectLinePrefix    = "bitrise-project|"
+	buildDirLinePrefix   = "bitrise-build-dir|"
+	buildTypeLinePrefix  = "bitrise-build-type|"
+	dependencyLinePrefix = "bitrise-dependency|"
+)
+
+// Graph is the project dependency graph of a Gradle build.
+type Graph struct {
+	// ProjectDirs maps Gradle project paths (:feature:login) to project directories.
+	ProjectDirs map[string]string
+	// BuildDirs maps Gradle project paths to build directories.
+	BuildDirs map[string]string
+	// BuildTypes maps the Gradle project paths of Android projects to their build type names.
+	BuildTypes map[string][]string
+	// Dependencies maps Gradle project paths to the paths of the projects they depend on.
+	Dependencies map[string][]string
+}
+
+// Selection describes the modules affected by a change.
+type Selection struct {
+	// FullRun is true if the change can affect every module, in this case FullRunReason explains why.
+	FullRun       bool
+	FullRunReason string
+	// Modules maps the affected module names (as used by gradle.Variants) to the reason of their selection.
+	Modules map[string]string
+}
+
+// LoadGraph reads the project graph written by the project graph init script (gradleconfig.WriteProjectGraphInitScript).
+func LoadGraph(pth string) (Graph, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return Graph{}, err
+	}
+	return ParseGraph(string(content)), nil
+}
+
+// ParseGraph parses the output of the project graph init script (gradleconfig.WriteProjectGraphInitScript).
+func ParseGraph(output string) Graph {
+	graph := Graph{
+		ProjectDirs:  map[string]string{},
+		BuildDirs:    map[string]string{},
+		BuildTypes:   map[string][]string{},
+		Dependencies: map[string][]string{},
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		if rest, ok := strings.CutPrefix(line, projectLinePrefix); ok {
+			if projectPath, dir, ok := strings.Cut(rest, "|"); ok {
+				graph.ProjectDirs[projectPath] = dir
+			}
+		} else if rest, ok := strings.CutPrefix(line, buildDirLinePrefix); ok {
+			if projectPath, dir, ok := strings.Cut(rest, "|"); ok {
+				graph.BuildDirs[projectPath] = dir
+			}
+		} else if rest, ok := strings.CutPrefix(line, buildTypeLinePrefix); ok {
+			if projectPath, buildType, ok := strings.Cut(rest, "|"); ok {
+				graph.BuildTypes[projectPath] = append(graph.BuildTypes[projectPath], buildType)
+			}
+		} else if rest, ok := strings.CutPrefix(line, dependencyLinePrefix); ok {
+			if projectPath, dependencyPath, ok := strings.Cut(rest, "|"); ok && projectPath != dependencyPath {
+				if !slices.Contains(graph.Dependencies[projectPath], dependencyPath) {
+					graph.Dependencies[projectPath] = append(graph.Dependencies[projectPath], dependencyPath)
+				}
+			}
+		}
+	}
+
+	return graph
+}
+
+// Select maps the changed files to the Gradle projects containing them and expands the result with their dependents.
+// rootDir is the root directory of the Gradle build, changedFiles are absolute paths.
+func Select(graph Graph, rootDir string, changedFiles []string) Selection {
+	directlyChanged := map[string][]string{}
+
+	for _, file := range changedFiles {
+		rel, err := filepath.Rel(rootDir, file)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// not part of the Gradle build
+			continue
+		}
+
+		if IsBuildLogicFile(rel) {
+			return Selection{FullRun: true, FullRunReason: fmt.Sprintf("build logic file changed: %s", filepath.ToSlash(rel))}
+		}
+
+		if projectPath := owningProject(graph, file); projectPath != "" {
+			directlyChanged[projectPath] = append(directlyChanged[projectPath], filepath.ToSlash(rel))
+		}
+	}
+
+	reasons := map[string]string{}
+	var queue []string
+	for _, projectPath := range sortedKeys(directlyChanged) {
+		files := directlyChanged[projectPath]
+		reason := fmt.Sprintf("changed: %s", files[0])
+		if len(files) > 1 {
+			reason += fmt.Sprintf(" and %d more file(s)", len(files)-1)
+		}
+		reasons[projectPath] = reason
+		queue = append(queue, projectPath)
+	}
+
+	dependents := reverseDependencies(graph)
+	for len(queue) > 0 {
+		projectPath := queue[0]
+		queue = queue[1:]
+
+		for _, dependent := range dependents[projectPath] {
+			if _, selected := reasons[dependent]; selected {
+				continue
+			}
+			reasons[dependent] = fmt.Sprintf("depends on %s", projectPath)
+			queue = append(queue, dependent)
+		}
+	}
+
+	modules := map[string]string{}
+	for projectPath, reason := range reasons {
+		modules[ModuleName(projectPath)] = reason
+	}
+
+	return Selection{Modules: modules}
+}
+
+// ModuleName converts a Gradle project path (:feature:login) to the module name used by gradle.Variants (feature:login).
+func ModuleName(projectPath string) string {
+	return strings.TrimPrefix(projectPath, ":")
+}
+
+// IsBuildLogicFile returns true if the file (relative to the Gradle root directory) can affect the build of every module.
+func IsBuildLogicFile(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	name := filepath.Base(rel)
+
+	switch {
+	case name == "settings.gradle" || name == "settings.gradle.kts":
+		return true
+	case strings.HasSuffix(name, ".versions.toml"):
+		return true
+	case rel == "build.gradle" || rel == "build.gradle.kts" || rel == "gradle.properties":
+		return true
+	case strings.HasPrefix(rel, "build-logic/") || strings.HasPrefix(rel, "buildSrc/") || strings.HasPrefix(rel, "gradle/"):
+		return true
+	}
+
+	return false
+}
+
+// owningProject returns the path of the project with the deepest directory containing the file.
+func owningProject(graph Graph, file string) string {
+	owner := ""
+	ownerDirLen := -1
+	for projectPath, dir := range graph.ProjectDirs {
+		if file != dir && !strings.HasPrefix(file, dir+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > ownerDirLen || (len(dir) == ownerDirLen && projectPath < owner) {
+			owner = projectPath
+			ownerDirLen = len(dir)
+		}
+	}
+	return owner
+}
+
+func reverseDependencies(graph Graph) map[string][]string {
+	dependents := map[string][]string{}
+	for _, projectPath := range sortedKeys(graph.Dependencies) {
+		for _, dependency := range graph.Dependencies[projectPath] {
+			dependents[dependency] = append(dependents[dependency], projectPath)
+		}
+	}
+	return dependents
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
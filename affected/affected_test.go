@@ -0,0 +1,126 @@
+package affected
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const graphOutput = `> Configure project :app
+bitrise-project|:|/project
+bitrise-project|:app|/project/app
+bitrise-project|:core|/project/core
+bitrise-project|:core:network|/project/core/network
+bitrise-project|:feature:login|/project/feature/login
+bitrise-project|:feature:settings|/project/feature/settings
+bitrise-build-dir|:app|/project/app/build
+bitrise-build-dir|:core|/project/core/out
+bitrise-build-type|:app|debug
+bitrise-build-type|:app|nonMinifiedRelease
+bitrise-dependency|:app|:feature:login
+bitrise-dependency|:app|:feature:settings
+bitrise-dependency|:app|:feature:settings
+bitrise-dependency|:feature:login|:core:network
+bitrise-dependency|:feature:settings|:core
+bitrise-dependency|:core|:core`
+
+func TestParseGraph(t *testing.T) {
+	got := ParseGraph(graphOutput)
+	require.Equal(t, Graph{
+		ProjectDirs: map[string]string{
+			":":                 "/project",
+			":app":              "/project/app",
+			":core":             "/project/core",
+			":core:network":     "/project/core/network",
+			":feature:login":    "/project/feature/login",
+			":feature:settings": "/project/feature/settings",
+		},
+		BuildDirs: map[string]string{
+			":app":  "/project/app/build",
+			":core": "/project/core/out",
+		},
+		BuildTypes: map[string][]string{
+			":app": {"debug", "nonMinifiedRelease"},
+		},
+		Dependencies: map[string][]string{
+			":app":              {":feature:login", ":feature:settings"},
+			":feature:login":    {":core:network"},
+			":feature:settings": {":core"},
+		},
+	}, got)
+}
+
+func TestSelect(t *testing.T) {
+	graph := ParseGraph(graphOutput)
+
+	tests := []struct {
+		name         string
+		changedFiles []string
+		want         Selection
+	}{
+		{
+			name:         "Nothing changed",
+			changedFiles: nil,
+			want:         Selection{Modules: map[string]string{}},
+		},
+		{
+			name:         "Changed module and its dependents are selected",
+			changedFiles: []string{"/project/core/network/src/main/java/Client.kt", "/project/core/network/build.gradle.kts"},
+			want: Selection{Modules: map[string]string{
+				"core:network":  "changed: core/network/src/main/java/Client.kt and 1 more file(s)",
+				"feature:login": "depends on :core:network",
+				"app":           "depends on :feature:login",
+			}},
+		},
+		{
+			name:         "Nested module is not confused with its parent",
+			changedFiles: []string{"/project/core/src/main/java/Util.kt"},
+			want: Selection{Modules: map[string]string{
+				"core":             "changed: core/src/main/java/Util.kt",
+				"feature:settings": "depends on :core",
+				"app":              "depends on :feature:settings",
+			}},
+		},
+		{
+			name:         "Files outside of the Gradle build are ignored",
+			changedFiles: []string{"/ios/App.swift", "/project-other/app/Main.kt"},
+			want:         Selection{Modules: map[string]string{}},
+		},
+		{
+			name:         "Build logic change selects everything",
+			changedFiles: []string{"/project/app/src/main/java/Main.kt", "/project/gradle/libs.versions.toml"},
+			want:         Selection{FullRun: true, FullRunReason: "build logic file changed: gradle/libs.versions.toml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Select(graph, "/project", tt.changedFiles)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIsBuildLogicFile(t *testing.T) {
+	for _, rel := range []string{
+		"settings.gradle",
+		"settings.gradle.kts",
+		"build.gradle.kts",
+		"gradle.properties",
+		"gradle/libs.versions.toml",
+		"gradle/wrapper/gradle-wrapper.properties",
+		"build-logic/convention/src/main/kotlin/AndroidLibraryConventionPlugin.kt",
+		"buildSrc/src/main/kotlin/Dependencies.kt",
+		"included/settings.gradle",
+	} {
+		require.True(t, IsBuildLogicFile(rel), rel)
+	}
+
+	for _, rel := range []string{
+		"app/build.gradle",
+		"app/gradle.properties",
+		"app/src/main/java/io/bitrise/gradle/Main.kt",
+		"README.md",
+	} {
+		require.False(t, IsBuildLogicFile(rel), rel)
+	}
+}
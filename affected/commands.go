@@ -0,0 +1,41 @@
+package affected
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/v2/command"
+	"github.com/bitrise-io/go-utils/v2/log"
+)
+
+// ChangedFiles returns the absolute paths of the files changed between the merge base of ref and HEAD
+// in the git repository containing dir.
+func ChangedFiles(cmdFactory command.Factory, dir, ref string, logger log.Logger) ([]string, error) {
+	opts := command.Opts{Dir: dir}
+
+	rootCmd := cmdFactory.Create("git", []string{"rev-parse", "--show-toplevel"}, &opts)
+	logger.Debugf("$ %s", rootCmd.PrintableCommandArgs())
+	repoRoot, err := rootCmd.RunAndReturnTrimmedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find git repository root: %s, %w", repoRoot, err)
+	}
+
+	diffCmd := cmdFactory.Create("git", []string{"diff", "--name-only", "--no-renames", ref + "...HEAD"}, &opts)
+	logger.Debugf("$ %s", diffCmd.PrintableCommandArgs())
+	diffOutput, err := diffCmd.RunAndReturnTrimmedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files since %s: %s, %w", ref, diffOutput, err)
+	}
+
+	var changedFiles []string
+	for _, line := range strings.Split(diffOutput, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		changedFiles = append(changedFiles, filepath.Join(repoRoot, line))
+	}
+
+	return changedFiles, nil
+}
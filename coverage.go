@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-utils/v2/command"
+	"github.com/bitrise-io/go-utils/v2/log"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/affected"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/coverage"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/output"
+)
+
+const (
+	koverHTMLReportTaskName = "koverHtmlReport"
+	// koverReportsDir is the directory (relative to the module's build directory) of the Kover variant reports:
+	// <module>/build/reports/kover/report<Variant>.xml and <module>/build/reports/kover/html<Variant>.
+	koverReportsDir = "reports/kover"
+)
+
+// coverageToolVariants are the tested variants grouped by the coverage tool reporting them.
+// JaCoCo variants are unit test task variants (DebugUnitTest), Kover variants are build variants (Debug).
+type coverageToolVariants struct {
+	Jacoco gradle.Variants
+	Kover  gradle.Variants
+}
+
+// splitCoverageVariants assigns the tested variants to Kover, if the module has a Kover XML report task
+// for the variant (koverXmlReportDebug for testDebugUnitTest), otherwise to the JaCoCo init script.
+func splitCoverageVariants(testVariants, koverVariants gradle.Variants) coverageToolVariants {
+	variants := coverageToolVariants{Jacoco: gradle.Variants{}, Kover: gradle.Variants{}}
+	for module, moduleVariants := range testVariants {
+		for _, variant := range moduleVariants {
+			koverVariant := strings.TrimSuffix(variant, "UnitTest")
+			if slices.Contains(koverVariants[module], koverVariant) {
+				variants.Kover[module] = append(variants.Kover[module], koverVariant)
+			} else {
+				variants.Jacoco[module] = append(variants.Jacoco[module], variant)
+			}
+		}
+	}
+	return variants
+}
+
+// runCoverageReports runs the JaCoCo report tasks registered by the coverage init script and the Kover report tasks
+// for the tested variants, exports the HTML and XML reports into the deploy dir and the coverage percentages as env vars.
+// Failures are only logged, the returned reports are checked against the coverage thresholds.
+func runCoverageReports(gradleProject gradle.Project, graph affected.Graph, projectDir string, variants coverageToolVariants, args []string, deployDir string, exporter output.Exporter, logger log.Logger) []coverage.Report {
+	var reports []coverage.Report
+
+	if len(variants.Jacoco) > 0 {
+		reportCommand := gradleProject.GetTask(gradleconfig.JacocoReportTaskName).GetCommand(variants.Jacoco, args...)
+		jacocoXMLReportPath := func(variant string) string {
+			return filepath.Join(filepath.FromSlash(gradleconfig.JacocoReportsDir), variant, gradleconfig.JacocoXMLReportFileName)
+		}
+		reports = append(reports, generateCoverageReports("JaCoCo", reportCommand, gradleProject, graph, projectDir, variants.Jacoco, gradleconfig.JacocoReportsDir, jacocoXMLReportPath, deployDir, exporter, logger)...)
+	}
+
+	if len(variants.Kover) > 0 {
+		// The Kover report tasks depend on the unit test tasks, which are excluded, so that the failed tests are not run again.
+		koverArgs := taskPaths(koverHTMLReportTaskName, "", variants.Kover)
+		for _, testTaskPath := range taskPaths("test", "UnitTest", variants.Kover) {
+			koverArgs = append(koverArgs, "-x", testTaskPath)
+		}
+		reportCommand := gradleProject.GetTask(gradleconfig.KoverXMLReportTaskName).GetCommand(variants.Kover, append(koverArgs, args...)...)
+		koverXMLReportPath := func(variant string) string {
+			return filepath.Join(filepath.FromSlash(koverReportsDir), "report"+upperFirst(variant)+".xml")
+		}
+		reports = append(reports, generateCoverageReports("Kover", reportCommand, gradleProject, graph, projectDir, variants.Kover, koverReportsDir, koverXMLReportPath, deployDir, exporter, logger)...)
+	}
+
+	if len(reports) == 0 {
+		logger.Println()
+		logger.Warnf("No coverage report found, the unit test tasks might not have run")
+		return nil
+	}
+
+	logger.Println()
+	logger.Infof("Export coverage:")
+
+	if err := exporter.ExportCoverage(reports); err != nil {
+		logger.Warnf("Failed to export coverage: %s", err)
+	}
+
+	return reports
+}
+
+// generateCoverageReports runs the report tasks of a coverage tool, exports its report directories
+// and parses the XML reports of the variants.
+func generateCoverageReports(tool string, reportCommand command.Command, gradleProject gradle.Project, graph affected.Graph, projectDir string, variants gradle.Variants, reportsDir string, xmlReportPath func(variant string) string, deployDir string, exporter output.Exporter, logger log.Logger) []coverage.Report {
+	logger.Println()
+	logger.Infof("Generate %s coverage reports:", tool)
+
+	started := time.Now()
+
+	logger.Donef("$ " + reportCommand.PrintableCommandArgs())
+
+	if err := reportCommand.Run(); err != nil {
+		logger.Warnf("%s coverage report task failed: %v", tool, err)
+		return nil
+	}
+
+	logger.Println()
+	logger.Infof("Export %s coverage reports:", tool)
+
+	// <project_dir>/app/build/reports/bitrise-coverage
+	// <project_dir>/app/build/reports/kover
+	reportDirs, err := getArtifacts(gradleProject, started, "*build/"+reportsDir, true, true, logger)
+	if err != nil {
+		logger.Warnf("Failed to find %s coverage reports: %s", tool, err)
+		return nil
+	}
+
+	if err := exporter.ExportArtifacts(deployDir, reportDirs); err != nil {
+		logger.Warnf("Failed to export %s coverage reports: %s", tool, err)
+	}
+
+	reports, err := coverageReports(graph, projectDir, variants, xmlReportPath)
+	if err != nil {
+		logger.Warnf("Failed to parse %s coverage reports: %s", tool, err)
+		return nil
+	}
+
+	return reports
+}
+
+// coverageReports parses the JaCoCo format XML reports (Kover XML reports use the same format) of the given variants.
+//
+// The path of a variant's report is resolved relative to the module's build directory (as reported by Gradle) by xmlReportPath,
+// from the lower camel case variant name (debug for both DebugUnitTest and Debug).
+// Variants without a report (for example, as their unit test task was up-to-date or did not run) are skipped.
+func coverageReports(graph affected.Graph, projectDir string, variants gradle.Variants, xmlReportPath func(variant string) string) ([]coverage.Report, error) {
+	var modules []string
+	for module := range variants {
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+
+	var reports []coverage.Report
+	for _, module := range modules {
+		buildDir := moduleBuildDir(graph, projectDir, strings.TrimPrefix(module, ":"))
+
+		for _, variant := range variants[module] {
+			variantName := lowerFirst(strings.TrimSuffix(variant, "UnitTest"))
+			pth := filepath.Join(buildDir, xmlReportPath(variantName))
+			if _, err := os.Stat(pth); os.IsNotExist(err) {
+				continue
+			}
+
+			report, err := coverage.ParseJacocoXML(pth)
+			if err != nil {
+				return nil, err
+			}
+			report.Module, report.Variant = strings.TrimPrefix(module, ":"), variantName
+			reports = append(reports, report)
+		}
+	}
+
+	return reports, nil
+}
+
+// taskPaths returns the sorted Gradle task paths of the variants (:app:testDebugUnitTest for the test task prefix,
+// the Debug variant of the app module and the UnitTest suffix).
+func taskPaths(prefix, suffix string, variants gradle.Variants) []string {
+	var paths []string
+	for module, moduleVariants := range variants {
+		for _, variant := range moduleVariants {
+			taskName := prefix + variant + suffix
+			if module != "" {
+				taskName = ":" + strings.TrimPrefix(module, ":") + ":" + taskName
+			}
+			paths = append(paths, taskName)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// parseCoverageRules reads the coverage rules of the rules file (if set), followed by the rules of the input.
+func parseCoverageRules(rulesFile, input string) ([]coverage.Rule, error) {
+	var rules []coverage.Rule
+	if rulesFile != "" {
+		fileRules, err := coverage.LoadRules(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	inputRules, err := coverage.ParseRules(input)
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, inputRules...), nil
+}
+
+// checkCoverageThresholds lists the violated coverage rules of the modules, and returns an error if any rule is violated.
+// Missing coverage reports count as a violation, as the thresholds could not be checked.
+func checkCoverageThresholds(reports []coverage.Report, rules []coverage.Rule, failOnViolation bool, logger log.Logger) error {
+	logger.Println()
+	logger.Infof("Check coverage thresholds:")
+
+	logViolation := logger.Warnf
+	if failOnViolation {
+		logViolation = logger.Errorf
+	}
+
+	if len(reports) == 0 {
+		logViolation("No coverage report found, the coverage thresholds could not be checked")
+		return fmt.Errorf("no coverage report found")
+	}
+
+	violations := coverage.CheckRules(reports, rules)
+	if len(violations) == 0 {
+		logger.Donef("Every module meets the coverage thresholds (%d rule(s) checked)", len(rules))
+		return nil
+	}
+
+	logViolation("%d coverage threshold(s) violated:", len(violations))
+	errMsg := ""
+	for _, violation := range violations {
+		logViolation("- %s", violation.String())
+		errMsg += fmt.Sprintf("- %s\n", violation.String())
+	}
+
+	return fmt.Errorf("%d coverage threshold(s) violated:\n%s", len(violations), errMsg)
+}
@@ -0,0 +1,110 @@
+package coverage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Counter counts the covered and missed lines (or branches) of a coverage report.
+type Counter struct {
+	Covered int
+	Missed  int
+}
+
+// Total returns the number of the covered and missed items.
+func (c Counter) Total() int {
+	return c.Covered + c.Missed
+}
+
+// Percent returns the covered percentage, false is returned if there is nothing to cover.
+func (c Counter) Percent() (float64, bool) {
+	if c.Total() == 0 {
+		return 0, false
+	}
+	return float64(c.Covered) * 100 / float64(c.Total()), true
+}
+
+func (c Counter) add(other Counter) Counter {
+	return Counter{Covered: c.Covered + other.Covered, Missed: c.Missed + other.Missed}
+}
+
+// Report is the line and branch coverage of a module's variant (or of a module, or of every module).
+type Report struct {
+	Module  string
+	Variant string
+	Line    Counter
+	Branch  Counter
+}
+
+type jacocoReport struct {
+	XMLName  xml.Name        `xml:"report"`
+	Counters []jacocoCounter `xml:"counter"`
+}
+
+type jacocoCounter struct {
+	Type    string `xml:"type,attr"`
+	Missed  int    `xml:"missed,attr"`
+	Covered int    `xml:"covered,attr"`
+}
+
+// ParseJacocoXML reads the line and branch counters of a JaCoCo XML report (the format Kover XML reports use as well).
+// Only the report level counters are read, which sum up the counters of every package.
+func ParseJacocoXML(pth string) (Report, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report jacocoReport
+	if err := xml.Unmarshal(content, &report); err != nil {
+		return Report{}, fmt.Errorf("failed to parse JaCoCo XML report (%s): %w", pth, err)
+	}
+
+	var parsed Report
+	for _, counter := range report.Counters {
+		switch counter.Type {
+		case "LINE":
+			parsed.Line = Counter{Covered: counter.Covered, Missed: counter.Missed}
+		case "BRANCH":
+			parsed.Branch = Counter{Covered: counter.Covered, Missed: counter.Missed}
+		}
+	}
+
+	return parsed, nil
+}
+
+// Total sums up the counters of the reports.
+func Total(reports []Report) Report {
+	var total Report
+	for _, report := range reports {
+		total.Line = total.Line.add(report.Line)
+		total.Branch = total.Branch.add(report.Branch)
+	}
+	return total
+}
+
+// ByModule sums up the counters of the reports per module, ordered by the module name.
+// The variants of a module are summed up, so classes shared by the variants are counted once per variant.
+func ByModule(reports []Report) []Report {
+	var modules []Report
+	indexes := map[string]int{}
+
+	for _, report := range reports {
+		i, ok := indexes[report.Module]
+		if !ok {
+			i = len(modules)
+			indexes[report.Module] = i
+			modules = append(modules, Report{Module: report.Module})
+		}
+		modules[i].Line = modules[i].Line.add(report.Line)
+		modules[i].Branch = modules[i].Branch.add(report.Branch)
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Module < modules[j].Module
+	})
+
+	return modules
+}
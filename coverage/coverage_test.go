@@ -0,0 +1,54 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJacocoXML(t *testing.T) {
+	report, err := ParseJacocoXML(filepath.Join("testdata", "jacoco.xml"))
+	require.NoError(t, err)
+	require.Equal(t, Report{
+		Line:   Counter{Covered: 130, Missed: 30},
+		Branch: Counter{Covered: 12, Missed: 8},
+	}, report)
+
+	percent, ok := report.Line.Percent()
+	require.True(t, ok)
+	require.InDelta(t, 81.25, percent, 0.0001)
+}
+
+func TestParseJacocoXML_Invalid(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "coverage.xml")
+	require.NoError(t, os.WriteFile(pth, []byte("<report>"), 0o644))
+
+	_, err := ParseJacocoXML(pth)
+	require.Error(t, err)
+}
+
+func TestCounter_Percent(t *testing.T) {
+	_, ok := Counter{}.Percent()
+	require.False(t, ok)
+
+	percent, ok := Counter{Covered: 1, Missed: 3}.Percent()
+	require.True(t, ok)
+	require.Equal(t, 25.0, percent)
+}
+
+func TestByModule(t *testing.T) {
+	reports := []Report{
+		{Module: "feature:login", Variant: "debug", Line: Counter{Covered: 10, Missed: 10}},
+		{Module: "app", Variant: "debug", Line: Counter{Covered: 30, Missed: 10}, Branch: Counter{Covered: 2, Missed: 2}},
+		{Module: "app", Variant: "release", Line: Counter{Covered: 20, Missed: 20}, Branch: Counter{Covered: 1, Missed: 3}},
+	}
+
+	require.Equal(t, []Report{
+		{Module: "app", Line: Counter{Covered: 50, Missed: 30}, Branch: Counter{Covered: 3, Missed: 5}},
+		{Module: "feature:login", Line: Counter{Covered: 10, Missed: 10}},
+	}, ByModule(reports))
+
+	require.Equal(t, Report{Line: Counter{Covered: 60, Missed: 40}, Branch: Counter{Covered: 3, Missed: 5}}, Total(reports))
+}
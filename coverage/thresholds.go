@@ -0,0 +1,227 @@
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+)
+
+const (
+	lineMetric   = "line"
+	branchMetric = "branch"
+)
+
+// Rule is a minimum line and branch coverage (in percent) of every module matching the module pattern,
+// or of every module together if the module pattern is empty. A zero minimum is not checked.
+type Rule struct {
+	Module string  `json:"module"`
+	Line   float64 `json:"line"`
+	Branch float64 `json:"branch"`
+}
+
+func (r Rule) String() string {
+	var minimums []string
+	if r.Line > 0 {
+		minimums = append(minimums, fmt.Sprintf("%s %s", lineMetric, formatPercent(r.Line)))
+	}
+	if r.Branch > 0 {
+		minimums = append(minimums, fmt.Sprintf("%s %s", branchMetric, formatPercent(r.Branch)))
+	}
+
+	if r.Module == "" {
+		return strings.Join(minimums, ", ")
+	}
+	return r.Module + ": " + strings.Join(minimums, ", ")
+}
+
+// Violation is a coverage metric of a module (or of every module together, if Module is empty) below the minimum of a rule,
+// or a module rule whose pattern matches no reported module (with an empty Metric).
+type Violation struct {
+	Rule    Rule
+	Module  string
+	Metric  string
+	Covered float64
+	Minimum float64
+}
+
+func (v Violation) String() string {
+	module := v.Module
+	if module == "" {
+		module = "overall"
+	}
+	if v.Metric == "" {
+		return fmt.Sprintf("%s: no coverage report of a matching module (rule %q)", module, v.Rule.String())
+	}
+	return fmt.Sprintf("%s: %s coverage %s%% is below %s%% (rule %q)", module, v.Metric, strconv.FormatFloat(v.Covered, 'f', 2, 64), formatPercent(v.Minimum), v.Rule.String())
+}
+
+// ParseRules parses the coverage rules, one rule per line:
+//
+//	line 70, branch 50
+//	app: line 80
+//	feature:*: line 60, branch 40
+//
+// A line without a module pattern applies to every module together, a module pattern can contain '*' wildcards.
+func ParseRules(input string) ([]Rule, error) {
+	var rules []Rule
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid coverage rule (%s): %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRule(line string) (Rule, error) {
+	var rule Rule
+
+	minimums := line
+	if i := strings.LastIndex(line, ":"); i != -1 {
+		rule.Module = strings.TrimPrefix(strings.TrimSpace(line[:i]), ":")
+		minimums = line[i+1:]
+	}
+
+	for _, minimum := range strings.Split(minimums, ",") {
+		fields := strings.Fields(minimum)
+		if len(fields) != 2 {
+			return Rule{}, fmt.Errorf("expected a '%s <percent>' or '%s <percent>' minimum, got: %s", lineMetric, branchMetric, strings.TrimSpace(minimum))
+		}
+
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid percent (%s): %w", fields[1], err)
+		}
+
+		switch fields[0] {
+		case lineMetric:
+			rule.Line = percent
+		case branchMetric:
+			rule.Branch = percent
+		default:
+			return Rule{}, fmt.Errorf("unknown coverage metric: %s", fields[0])
+		}
+	}
+
+	return rule, validateRule(rule)
+}
+
+func validateRule(rule Rule) error {
+	for _, percent := range []float64{rule.Line, rule.Branch} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("minimum %s should be between 0 and 100", formatPercent(percent))
+		}
+	}
+	return nil
+}
+
+// rulesFile is the JSON format of the coverage rules file:
+//
+//	{
+//	  "line": 70,
+//	  "branch": 50,
+//	  "modules": [
+//	    {"module": "app", "line": 80},
+//	    {"module": "feature:*", "line": 60, "branch": 40}
+//	  ]
+//	}
+type rulesFile struct {
+	Line    float64 `json:"line"`
+	Branch  float64 `json:"branch"`
+	Modules []Rule  `json:"modules"`
+}
+
+// LoadRules reads the coverage rules from a JSON rules file, the overall minimums come first, followed by the module rules.
+func LoadRules(pth string) ([]Rule, error) {
+	content, err := os.ReadFile(pth)
+	if err != nil {
+		return nil, err
+	}
+
+	var file rulesFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse coverage rules file (%s): %w", pth, err)
+	}
+
+	var rules []Rule
+	if file.Line > 0 || file.Branch > 0 {
+		rules = append(rules, Rule{Line: file.Line, Branch: file.Branch})
+	}
+	for _, rule := range file.Modules {
+		if rule.Module = strings.TrimPrefix(strings.TrimSpace(rule.Module), ":"); rule.Module == "" {
+			return nil, fmt.Errorf("invalid coverage rule in %s: module rule without module pattern", pth)
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, rule := range rules {
+		if err := validateRule(rule); err != nil {
+			return nil, fmt.Errorf("invalid coverage rule (%s) in %s: %w", rule.String(), pth, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// CheckRules checks every rule against the coverage of the matching modules (or of every module together),
+// and returns the violations in the order of the rules and the modules.
+// Module patterns are matched as the module input, '*' matches any sequence of characters. A module rule matching
+// no reported module is a violation, as it most likely refers to a renamed module or an untested one.
+// Metrics with nothing to cover (for example the branch coverage of a module without branches) are not checked.
+func CheckRules(reports []Report, rules []Rule) []Violation {
+	modules := ByModule(reports)
+
+	var violations []Violation
+	for _, rule := range rules {
+		if rule.Module == "" {
+			violations = append(violations, checkRule(rule, Total(reports))...)
+			continue
+		}
+
+		pattern := gradleconfig.GlobRegexp(rule.Module, false)
+		matched := false
+		for _, module := range modules {
+			if pattern.MatchString(module.Module) {
+				matched = true
+				violations = append(violations, checkRule(rule, module)...)
+			}
+		}
+		if !matched {
+			violations = append(violations, Violation{Rule: rule, Module: rule.Module})
+		}
+	}
+	return violations
+}
+
+func checkRule(rule Rule, report Report) []Violation {
+	var violations []Violation
+	for _, metric := range []struct {
+		name    string
+		counter Counter
+		minimum float64
+	}{
+		{lineMetric, report.Line, rule.Line},
+		{branchMetric, report.Branch, rule.Branch},
+	} {
+		percent, ok := metric.counter.Percent()
+		if !ok || metric.minimum <= 0 || percent >= metric.minimum {
+			continue
+		}
+		violations = append(violations, Violation{Rule: rule, Module: report.Module, Metric: metric.name, Covered: percent, Minimum: metric.minimum})
+	}
+	return violations
+}
+
+func formatPercent(percent float64) string {
+	return strconv.FormatFloat(percent, 'f', -1, 64)
+}
@@ -0,0 +1,86 @@
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(`line 70, branch 50
+
+app: line 80%
+:feature:*: line 60.5, branch 40`)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{
+		{Line: 70, Branch: 50},
+		{Module: "app", Line: 80},
+		{Module: "feature:*", Line: 60.5, Branch: 40},
+	}, rules)
+
+	for _, input := range []string{
+		"app: line",
+		"app: lines 80",
+		"app: line eighty",
+		"app: branch 120",
+	} {
+		_, err := ParseRules(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "coverage-rules.json")
+	require.NoError(t, os.WriteFile(pth, []byte(`{
+  "line": 70,
+  "modules": [
+    {"module": "app", "line": 80},
+    {"module": "feature:*", "line": 60, "branch": 40}
+  ]
+}`), 0o644))
+
+	rules, err := LoadRules(pth)
+	require.NoError(t, err)
+	require.Equal(t, []Rule{
+		{Line: 70},
+		{Module: "app", Line: 80},
+		{Module: "feature:*", Line: 60, Branch: 40},
+	}, rules)
+
+	require.NoError(t, os.WriteFile(pth, []byte(`{"modules": [{"line": 80}]}`), 0o644))
+	_, err = LoadRules(pth)
+	require.Error(t, err)
+}
+
+func TestCheckRules(t *testing.T) {
+	reports := []Report{
+		{Module: "app", Variant: "debug", Line: Counter{Covered: 75, Missed: 25}, Branch: Counter{Covered: 8, Missed: 2}},
+		{Module: "feature:login", Variant: "debug", Line: Counter{Covered: 50, Missed: 50}},
+		{Module: "feature:search", Variant: "debug", Line: Counter{Covered: 90, Missed: 10}, Branch: Counter{Covered: 1, Missed: 3}},
+	}
+	rules := []Rule{
+		{Line: 75, Branch: 50},
+		{Module: "app", Line: 80},
+		{Module: "feature:*", Line: 60, Branch: 40},
+		// path.Match would not match across the ':' separated module path.
+		{Module: "feat*h", Line: 95},
+		{Module: "legacy", Line: 50},
+	}
+
+	violations := CheckRules(reports, rules)
+
+	var messages []string
+	for _, violation := range violations {
+		messages = append(messages, violation.String())
+	}
+	require.Equal(t, []string{
+		`overall: line coverage 71.67% is below 75% (rule "line 75, branch 50")`,
+		`app: line coverage 75.00% is below 80% (rule "app: line 80")`,
+		`feature:login: line coverage 50.00% is below 60% (rule "feature:*: line 60, branch 40")`,
+		`feature:search: branch coverage 25.00% is below 40% (rule "feature:*: line 60, branch 40")`,
+		`feature:search: line coverage 90.00% is below 95% (rule "feat*h: line 95")`,
+		`legacy: no coverage report of a matching module (rule "legacy: line 50")`,
+	}, messages)
+}
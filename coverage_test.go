@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-utils/v2/log"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/affected"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/coverage"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_coverageReports(t *testing.T) {
+	projectDir := t.TempDir()
+	writeReport := func(buildDir, variant string, missed, covered int) {
+		dir := filepath.Join(projectDir, buildDir, "reports", "bitrise-coverage", variant)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		content := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><!DOCTYPE report PUBLIC "-//JACOCO//DTD Report 1.1//EN" "report.dtd">`+
+			`<report name="%s"><counter type="LINE" missed="%d" covered="%d"/></report>`, buildDir, missed, covered)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "coverage.xml"), []byte(content), 0o644))
+	}
+	writeReport(filepath.Join("app", "build"), "debug", 10, 30)
+	// A module with a custom build directory.
+	writeReport(filepath.Join("modules", "login", "out"), "freeRelease", 5, 5)
+	writeReport(filepath.Join("feature", "login", "build"), "freeRelease", 1, 1)
+
+	graph := affected.Graph{
+		BuildDirs: map[string]string{":feature:login": filepath.Join(projectDir, "modules", "login", "out")},
+	}
+	reports, err := coverageReports(graph, projectDir, gradle.Variants{
+		"feature:login": {"FreeReleaseUnitTest"},
+		"app":           {"DebugUnitTest", "ReleaseUnitTest"},
+	}, func(variant string) string {
+		return filepath.Join("reports", "bitrise-coverage", variant, "coverage.xml")
+	})
+	require.NoError(t, err)
+	require.Equal(t, []coverage.Report{
+		{Module: "app", Variant: "debug", Line: coverage.Counter{Covered: 30, Missed: 10}},
+		{Module: "feature:login", Variant: "freeRelease", Line: coverage.Counter{Covered: 5, Missed: 5}},
+	}, reports)
+}
+
+func Test_splitCoverageVariants(t *testing.T) {
+	testVariants := gradle.Variants{
+		"app":           {"DebugUnitTest", "ReleaseUnitTest"},
+		"feature:login": {"FreeDebugUnitTest"},
+	}
+	koverVariants := gradle.Variants{
+		"feature:login": {"FreeDebug", "FreeRelease"},
+	}
+
+	require.Equal(t, coverageToolVariants{
+		Jacoco: gradle.Variants{"app": {"DebugUnitTest", "ReleaseUnitTest"}},
+		Kover:  gradle.Variants{"feature:login": {"FreeDebug"}},
+	}, splitCoverageVariants(testVariants, koverVariants))
+}
+
+func Test_taskPaths(t *testing.T) {
+	variants := gradle.Variants{
+		"feature:login": {"FreeDebug"},
+		"app":           {"Release", "Debug"},
+	}
+
+	require.Equal(t, []string{":app:testDebugUnitTest", ":app:testReleaseUnitTest", ":feature:login:testFreeDebugUnitTest"}, taskPaths("test", "UnitTest", variants))
+	require.Equal(t, []string{"koverHtmlReportDebug"}, taskPaths(koverHTMLReportTaskName, "", gradle.Variants{"": {"Debug"}}))
+}
+
+func Test_checkCoverageThresholds(t *testing.T) {
+	reports := []coverage.Report{
+		{Module: "app", Variant: "debug", Line: coverage.Counter{Covered: 75, Missed: 25}},
+		{Module: "feature:login", Variant: "debug", Line: coverage.Counter{Covered: 90, Missed: 10}},
+	}
+	rules := []coverage.Rule{{Line: 85}, {Module: "app", Line: 80}, {Module: "feature:*", Line: 80}}
+
+	err := checkCoverageThresholds(reports, rules, true, log.NewLogger())
+	require.EqualError(t, err, `2 coverage threshold(s) violated:
+- overall: line coverage 82.50% is below 85% (rule "line 85")
+- app: line coverage 75.00% is below 80% (rule "app: line 80")
+`)
+
+	require.NoError(t, checkCoverageThresholds(reports, rules[2:], true, log.NewLogger()))
+	require.Error(t, checkCoverageThresholds(nil, rules, false, log.NewLogger()))
+}
@@ -0,0 +1,204 @@
+package flakiness
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// HistoryFileName is the name of the history file in the history directory.
+	HistoryFileName = "flakiness-history.json"
+	// HistorySize is the number of the most recent builds kept for every test case,
+	// test cases which did not run in as many builds are dropped from the history.
+	HistorySize = 50
+	// MinBuilds is the number of builds a test case needs to run in before its flakiness rate is reported,
+	// so that a single failure in a short history (PF) is not reported as flaky.
+	MinBuilds = 10
+
+	historyVersion = 1
+)
+
+// Outcome is the result of a test case in a single build.
+type Outcome byte
+
+const (
+	// Passed means every execution of the test case passed.
+	Passed Outcome = 'P'
+	// Failed means every execution of the test case failed.
+	Failed Outcome = 'F'
+	// Mixed means the test case both passed and failed in the same build (for example it passed on a retry).
+	Mixed Outcome = 'M'
+)
+
+// TestID identifies a test case: the test suite (<module>-<variant>) it runs in, its class and method.
+type TestID struct {
+	TestSuiteName string `json:"test_suite_name,omitempty"`
+	ClassName     string `json:"class_name"`
+	Method        string `json:"method"`
+}
+
+// History is the per-test outcome history of the recent builds.
+type History struct {
+	Version int `json:"version"`
+	// Builds is the number of builds added to the history.
+	Builds int           `json:"builds,omitempty"`
+	Tests  []TestHistory `json:"tests"`
+}
+
+// TestHistory is the outcome history of a single test case.
+// Outcomes holds one character per build (P: passed, F: failed, M: mixed), the most recent build is the last one.
+type TestHistory struct {
+	TestID
+	Outcomes string `json:"outcomes"`
+	// LastBuild is the number of the last build (see History.Builds) the test case ran in.
+	LastBuild int `json:"last_build,omitempty"`
+}
+
+// FlakyTest is a test case with a flakiness rate above the threshold.
+type FlakyTest struct {
+	TestID
+	Rate   float64
+	Builds int
+}
+
+// Load reads the history from the given directory, an empty history is returned if the history file does not exist yet.
+func Load(dir string) (*History, error) {
+	content, err := os.ReadFile(filepath.Join(dir, HistoryFileName))
+	if os.IsNotExist(err) {
+		return &History{Version: historyVersion}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read flakiness history: %w", err)
+	}
+
+	var history History
+	if err := json.Unmarshal(content, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse flakiness history: %w", err)
+	}
+	if history.Version != historyVersion {
+		return nil, fmt.Errorf("unsupported flakiness history version: %d", history.Version)
+	}
+
+	return &history, nil
+}
+
+// Save writes the history into the given directory.
+func (h *History) Save(dir string) error {
+	content, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, HistoryFileName), content, 0o644)
+}
+
+// Add appends the outcomes of a build to the history, keeping the last HistorySize builds of every test case.
+// Test cases which did not run in the build are left unchanged, unless they did not run in the last HistorySize builds
+// (for example as they were removed or renamed), in that case they are dropped.
+func (h *History) Add(outcomes map[TestID]Outcome) {
+	h.Builds++
+
+	indexes := map[TestID]int{}
+	for i, test := range h.Tests {
+		indexes[test.TestID] = i
+	}
+
+	for id, outcome := range outcomes {
+		i, ok := indexes[id]
+		if !ok {
+			i = len(h.Tests)
+			indexes[id] = i
+			h.Tests = append(h.Tests, TestHistory{TestID: id})
+		}
+
+		testOutcomes := h.Tests[i].Outcomes + string(outcome)
+		if len(testOutcomes) > HistorySize {
+			testOutcomes = testOutcomes[len(testOutcomes)-HistorySize:]
+		}
+		h.Tests[i].Outcomes = testOutcomes
+		h.Tests[i].LastBuild = h.Builds
+	}
+
+	h.Tests = slices.DeleteFunc(h.Tests, func(test TestHistory) bool {
+		return h.Builds-test.LastBuild >= HistorySize
+	})
+
+	sort.Slice(h.Tests, func(i, j int) bool {
+		return lessTestID(h.Tests[i].TestID, h.Tests[j].TestID)
+	})
+}
+
+// FlakyTests returns the test cases with a flakiness rate at or above the threshold (between 0 and 1),
+// which ran in at least MinBuilds builds, ordered by decreasing rate.
+func (h *History) FlakyTests(threshold float64) []FlakyTest {
+	var flakyTests []FlakyTest
+	for _, test := range h.Tests {
+		if len(test.Outcomes) < MinBuilds {
+			continue
+		}
+
+		rate := Rate(test.Outcomes)
+		if rate == 0 || rate < threshold {
+			continue
+		}
+		flakyTests = append(flakyTests, FlakyTest{TestID: test.TestID, Rate: rate, Builds: len(test.Outcomes)})
+	}
+
+	sort.SliceStable(flakyTests, func(i, j int) bool {
+		if flakyTests[i].Rate != flakyTests[j].Rate {
+			return flakyTests[i].Rate > flakyTests[j].Rate
+		}
+		return lessTestID(flakyTests[i].TestID, flakyTests[j].TestID)
+	})
+
+	return flakyTests
+}
+
+// PassedConsistently checks if the test case ran in at least MinBuilds builds and passed in each of the last MinBuilds ones.
+func (h *History) PassedConsistently(id TestID) bool {
+	for _, test := range h.Tests {
+		if test.TestID != id {
+			continue
+		}
+		return len(test.Outcomes) >= MinBuilds && strings.Count(test.Outcomes[len(test.Outcomes)-MinBuilds:], string(Passed)) == MinBuilds
+	}
+	return false
+}
+
+// Rate is the rolling flakiness rate of the outcomes: the share of builds in which the test case both passed and failed,
+// or its outcome changed compared to the previous build.
+// A test case, which is broken since a build, flips only once, so it is not reported as flaky for long.
+func Rate(outcomes string) float64 {
+	if len(outcomes) == 0 {
+		return 0
+	}
+
+	flips := 0
+	for i := 0; i < len(outcomes); i++ {
+		outcome := Outcome(outcomes[i])
+		if outcome == Mixed {
+			flips++
+		} else if i > 0 && Outcome(outcomes[i-1]) != Mixed && Outcome(outcomes[i-1]) != outcome {
+			flips++
+		}
+	}
+
+	return float64(flips) / float64(len(outcomes))
+}
+
+func lessTestID(a, b TestID) bool {
+	if a.ClassName != b.ClassName {
+		return a.ClassName < b.ClassName
+	}
+	if a.Method != b.Method {
+		return a.Method < b.Method
+	}
+	return a.TestSuiteName < b.TestSuiteName
+}
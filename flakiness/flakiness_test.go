@@ -0,0 +1,101 @@
+package flakiness
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes string
+		want     float64
+	}{
+		{name: "No history", outcomes: "", want: 0},
+		{name: "Always passing", outcomes: "PPPP", want: 0},
+		{name: "Always failing", outcomes: "FFFF", want: 0},
+		{name: "Broken since a build", outcomes: "PPPPPPPFFF", want: 0.1},
+		{name: "Failing once in every twenty builds", outcomes: "PPPPPPPPPFPPPPPPPPPP", want: 0.1},
+		{name: "Passing on a retry", outcomes: "PPMP", want: 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.InDelta(t, tt.want, Rate(tt.outcomes), 0.0001)
+		})
+	}
+}
+
+func TestHistory_Add(t *testing.T) {
+	dir := t.TempDir()
+
+	history, err := Load(dir)
+	require.NoError(t, err)
+	require.Empty(t, history.Tests)
+
+	parses := TestID{TestSuiteName: "app-debug", ClassName: "com.acme.ParserTest", Method: "parses"}
+	formats := TestID{TestSuiteName: "app-debug", ClassName: "com.acme.FormatterTest", Method: "formats"}
+	for i := 0; i < HistorySize+5; i++ {
+		outcomes := map[TestID]Outcome{parses: Passed}
+		if i%5 == 0 {
+			outcomes[parses] = Failed
+		}
+		// The formatter test is removed after the first builds.
+		if i < 3 {
+			outcomes[formats] = Passed
+		}
+		history.Add(outcomes)
+	}
+	require.NoError(t, history.Save(dir))
+
+	history, err = Load(dir)
+	require.NoError(t, err)
+	// The formatter test did not run in the last HistorySize builds, so it is dropped.
+	require.Equal(t, HistorySize+5, history.Builds)
+	require.Equal(t, []TestHistory{
+		{TestID: parses, Outcomes: strings.Repeat("FPPPP", HistorySize/5), LastBuild: HistorySize + 5},
+	}, history.Tests)
+
+	require.Equal(t, []FlakyTest{{TestID: parses, Rate: 0.38, Builds: HistorySize}}, history.FlakyTests(0.1))
+	require.Empty(t, history.FlakyTests(0.5))
+}
+
+func TestHistory_FlakyTests_shortHistory(t *testing.T) {
+	parses := TestID{TestSuiteName: "app-debug", ClassName: "com.acme.ParserTest", Method: "parses"}
+	history := History{Version: historyVersion}
+	for _, outcome := range "PF" + strings.Repeat("P", MinBuilds-3) {
+		history.Add(map[TestID]Outcome{parses: Outcome(outcome)})
+	}
+	require.Empty(t, history.FlakyTests(0.1))
+
+	history.Add(map[TestID]Outcome{parses: Failed})
+	require.Equal(t, []FlakyTest{{TestID: parses, Rate: 0.3, Builds: MinBuilds}}, history.FlakyTests(0.1))
+}
+
+func TestHistory_PassedConsistently(t *testing.T) {
+	parses := TestID{TestSuiteName: "app-debug", ClassName: "com.acme.ParserTest", Method: "parses"}
+	formats := TestID{TestSuiteName: "app-debug", ClassName: "com.acme.FormatterTest", Method: "formats"}
+	history := History{Version: historyVersion, Tests: []TestHistory{
+		{TestID: parses, Outcomes: "FM" + strings.Repeat("P", MinBuilds)},
+		{TestID: formats, Outcomes: strings.Repeat("P", MinBuilds-1)},
+	}}
+
+	require.True(t, history.PassedConsistently(parses))
+	require.False(t, history.PassedConsistently(formats))
+	require.False(t, history.PassedConsistently(TestID{ClassName: "com.acme.ParserTest", Method: "parses"}))
+
+	history.Add(map[TestID]Outcome{parses: Mixed, formats: Passed})
+	require.False(t, history.PassedConsistently(parses))
+	require.True(t, history.PassedConsistently(formats))
+}
+
+func TestLoad_unsupportedVersion(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, HistoryFileName), []byte(`{"version":2,"tests":[]}`), 0o644))
+
+	_, err := Load(dir)
+	require.EqualError(t, err, "unsupported flakiness history version: 2")
+}
@@ -0,0 +1,109 @@
+package gradleconfig
+
+import (
+	"bytes"
+	"text/template"
+)
+
+const (
+	// JacocoReportTaskName is the name prefix of the JaCoCo report tasks registered by the coverage init script,
+	// followed by the variant of the unit test task: bitriseJacocoReportDebugUnitTest reports the coverage of testDebugUnitTest.
+	JacocoReportTaskName = "bitriseJacocoReport"
+	// JacocoReportsDir is the directory (relative to the module's build directory) the JaCoCo reports are written into:
+	// <module>/build/reports/bitrise-coverage/<variant>/coverage.xml and <module>/build/reports/bitrise-coverage/<variant>/html.
+	JacocoReportsDir = "reports/bitrise-coverage"
+	// JacocoXMLReportFileName is the name of the JaCoCo XML report in the variant's report directory.
+	JacocoXMLReportFileName = "coverage.xml"
+	// KoverXMLReportTaskName is the name prefix of the Kover XML report tasks, followed by the build variant (koverXmlReportDebug).
+	KoverXMLReportTaskName = "koverXmlReport"
+)
+
+// The report tasks are registered once every project is evaluated, as the Android Gradle Plugin creates
+// the unit test tasks in an afterEvaluate callback.
+// The report tasks do not depend on the unit test tasks, so that running them does not rerun the failed tests,
+// the report is skipped if its unit test task did not run.
+const jacocoGradleInitScriptTemplateText = `val bitriseCoverageExcludes = listOf("**/R.class", "**/R$*.class", "**/BuildConfig.*", "**/Manifest*.*")
+val bitriseKoverTestTasks: Set<String> = setOf({{ kotlinList .KoverTestTaskPaths }})
+
+gradle.projectsEvaluated {
+    rootProject.allprojects {
+        // The unit test tasks of the variants reported by Kover are skipped.
+        val unitTestTasks = tasks.withType<Test>().matching { it.name.startsWith("test") && it.name.endsWith("UnitTest") && it.path !in bitriseKoverTestTasks }.toList()
+        if (unitTestTasks.isEmpty()) {
+            return@allprojects
+        }
+
+        apply(plugin = "jacoco")
+
+        unitTestTasks.forEach { testTask ->
+            testTask.extensions.configure<org.gradle.testing.jacoco.plugins.JacocoTaskExtension> {
+                isIncludeNoLocationClasses = true
+                excludes = listOf("jdk.internal.*")
+            }
+
+            val variant = testTask.name.removePrefix("test").removeSuffix("UnitTest").replaceFirstChar { it.lowercase() }
+            tasks.register<org.gradle.testing.jacoco.tasks.JacocoReport>({{ kotlin .TaskName }} + testTask.name.removePrefix("test")) {
+                executionData(testTask)
+                mustRunAfter(testTask)
+                classDirectories.from(
+                    fileTree(layout.buildDirectory.dir("intermediates/javac/$variant")) {
+                        include("**/classes/**")
+                        exclude(bitriseCoverageExcludes)
+                    },
+                    fileTree(layout.buildDirectory.dir("tmp/kotlin-classes/$variant")) {
+                        exclude(bitriseCoverageExcludes)
+                    }
+                )
+                sourceDirectories.from(files("src/main/java", "src/main/kotlin", "src/$variant/java", "src/$variant/kotlin"))
+                reports {
+                    xml.required.set(true)
+                    html.required.set(true)
+                    xml.outputLocation.set(layout.buildDirectory.file({{ kotlin .ReportsDir }} + "/$variant/" + {{ kotlin .XMLReportFileName }}))
+                    html.outputLocation.set(layout.buildDirectory.dir({{ kotlin .ReportsDir }} + "/$variant/html"))
+                }
+            }
+        }
+    }
+}`
+
+type jacocoTemplateData struct {
+	TaskName           string
+	ReportsDir         string
+	XMLReportFileName  string
+	KoverTestTaskPaths []string
+}
+
+// WriteJacocoInitScript writes a Gradle init script, which applies the JaCoCo agent to the local unit test tasks
+// and registers a JaCoCo report task (see JacocoReportTaskName) for each of them.
+// The unit test tasks of the given paths (:app:testDebugUnitTest), whose coverage is reported by Kover, are skipped.
+func WriteJacocoInitScript(koverTestTaskPaths []string) (string, error) {
+	initScriptContent, err := generateJacocoGradleInitScriptContent(koverTestTaskPaths)
+	if err != nil {
+		return "", err
+	}
+
+	return writeInitScript("bitrise-jacoco.init.gradle.kts", initScriptContent)
+}
+
+func generateJacocoGradleInitScriptContent(koverTestTaskPaths []string) (string, error) {
+	tmpl, err := template.New("bitrise-jacoco.init.gradle.kts").Funcs(template.FuncMap{
+		"kotlin":     kotlinStringLiteral,
+		"kotlinList": kotlinStringList,
+	}).Parse(jacocoGradleInitScriptTemplateText)
+	if err != nil {
+		return "", err
+	}
+
+	resultBuffer := bytes.Buffer{}
+	templateData := jacocoTemplateData{
+		TaskName:           JacocoReportTaskName,
+		ReportsDir:         JacocoReportsDir,
+		XMLReportFileName:  JacocoXMLReportFileName,
+		KoverTestTaskPaths: koverTestTaskPaths,
+	}
+	if err := tmpl.Execute(&resultBuffer, templateData); err != nil {
+		return "", err
+	}
+
+	return resultBuffer.String(), nil
+}
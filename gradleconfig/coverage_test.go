@@ -0,0 +1,25 @@
+package gradleconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_generateJacocoGradleInitScriptContent(t *testing.T) {
+	got, err := generateJacocoGradleInitScriptContent([]string{":feature:login:testDebugUnitTest"})
+	require.NoError(t, err)
+	require.Contains(t, got, `apply(plugin = "jacoco")`)
+	require.Contains(t, got, `val bitriseKoverTestTasks: Set<String> = setOf(":feature:login:testDebugUnitTest")`)
+	require.Contains(t, got, `it.path !in bitriseKoverTestTasks`)
+	require.Contains(t, got, `tasks.register<org.gradle.testing.jacoco.tasks.JacocoReport>("bitriseJacocoReport" + testTask.name.removePrefix("test")) {`)
+	require.Contains(t, got, `xml.outputLocation.set(layout.buildDirectory.file("reports/bitrise-coverage" + "/$variant/" + "coverage.xml"))`)
+	require.Contains(t, got, `html.outputLocation.set(layout.buildDirectory.dir("reports/bitrise-coverage" + "/$variant/html"))`)
+	require.NotContains(t, got, "dependsOn")
+}
+
+func Test_generateJacocoGradleInitScriptContent_withoutKover(t *testing.T) {
+	got, err := generateJacocoGradleInitScriptContent(nil)
+	require.NoError(t, err)
+	require.Contains(t, got, `val bitriseKoverTestTasks: Set<String> = setOf()`)
+}
@@ -0,0 +1,129 @@
+package gradleconfig
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// junit5SignatureRegexp matches the method signature suffix JUnit 5 appends to the test case name
+// in the JUnit XML, optionally followed by the parameterized invocation index: parses(String)[1].
+var junit5SignatureRegexp = regexp.MustCompile(`^([^(]+)\([^)]*\)(\[[^\]]*\])?$`)
+
+// TestFilterPattern returns the Gradle test filter pattern selecting the given test case of a JUnit XML report,
+// or the whole class if testName is empty.
+//
+// The JUnit 5 method signature (and invocation index) is dropped, as Gradle filters JUnit 5 tests by their method name.
+// Gradle splits patterns by '.' into class and method name parts and has no escape sequence, so the characters
+// of the test name, which would be misinterpreted ('.' and '*'), are replaced by a '*' wildcard.
+func TestFilterPattern(className, testName string) string {
+	if testName == "" {
+		return className
+	}
+
+	if match := junit5SignatureRegexp.FindStringSubmatch(testName); match != nil {
+		testName = match[1]
+	}
+	testName = strings.ReplaceAll(testName, ".", "*")
+
+	return className + "." + testName
+}
+
+// classNameSegmentRegexp matches a package or class name segment of a test filter pattern: a Java identifier
+// ('$' separates nested classes) with '*' wildcards.
+var classNameSegmentRegexp = regexp.MustCompile(`^[\p{L}_$*][\p{L}\p{N}_$*]*$`)
+
+// lastSegmentRegexp matches the last segment of a test filter pattern, which is either a class name or a test name.
+// Test names (for example Kotlin names in backticks, JUnit 5 display names and parameterized test cases)
+// can contain any character after the first one.
+var lastSegmentRegexp = regexp.MustCompile(`^[\p{L}\p{N}_$*]`)
+
+// ValidateTestPattern checks if the pattern follows the syntax of the Gradle test filter patterns,
+// so that an invalid pattern fails the step before Gradle starts.
+//
+// Gradle splits the pattern by '.' into name segments: the package and class name segments are identifiers
+// with '*' wildcards, the last segment is a class name or a test name.
+func ValidateTestPattern(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("empty pattern")
+	}
+
+	for _, r := range pattern {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("pattern %q contains a control character", pattern)
+		}
+	}
+
+	segments := strings.Split(pattern, ".")
+	for i, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("pattern %q contains an empty name segment", pattern)
+		}
+
+		if i == len(segments)-1 {
+			if !lastSegmentRegexp.MatchString(segment) {
+				return fmt.Errorf("pattern %q contains an invalid class or test name: %s", pattern, segment)
+			}
+		} else if !classNameSegmentRegexp.MatchString(segment) {
+			return fmt.Errorf("pattern %q contains an invalid package or class name: %s", pattern, segment)
+		}
+	}
+
+	return nil
+}
+
+func validateTestPatterns(patterns []TestPattern) error {
+	var errs []string
+	for _, pattern := range patterns {
+		if err := ValidateTestPattern(pattern.Pattern); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid test filter pattern(s): %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// kotlinStringLiteral returns the value as a double-quoted Kotlin string literal,
+// escaping the characters which would terminate the literal or start a string template.
+func kotlinStringLiteral(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '$':
+			b.WriteString(`\$`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func kotlinStringList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, kotlinStringLiteral(value))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,101 @@
+package gradleconfig
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestFilterPattern(t *testing.T) {
+	converter := junitxml.Converter{}
+	require.True(t, converter.Detect([]string{filepath.Join("testdata", "TEST-io.bitrise.sample.ParserTest.xml")}))
+	testReport, err := converter.Convert()
+	require.NoError(t, err)
+	require.Len(t, testReport.TestSuites, 1)
+
+	want := []string{
+		"io.bitrise.sample.ParserTest.parses empty input",
+		"io.bitrise.sample.ParserTest.formats ${amount} as price",
+		`io.bitrise.sample.ParserTest.parses[0: "1*5"]`,
+		"io.bitrise.sample.ParserTest.parsesDecimal",
+		"io.bitrise.sample.ParserTest.rejectsBlankInput",
+		"io.bitrise.sample.ParserTest$Nested.parsesNestedValue",
+		`io.bitrise.sample.ParserTest$Nested.parses \ escaped input`,
+	}
+
+	var got []string
+	for _, testCase := range testReport.TestSuites[0].TestCases {
+		pattern := TestFilterPattern(testCase.ClassName, testCase.Name)
+		require.NoError(t, ValidateTestPattern(pattern))
+		require.True(t, MatchesTestPattern(pattern, testCase.ClassName, testCase.Name), pattern)
+		got = append(got, pattern)
+	}
+	require.Equal(t, want, got)
+
+	require.Equal(t, "io.bitrise.sample.ParserTest", TestFilterPattern("io.bitrise.sample.ParserTest", ""))
+}
+
+func TestValidateTestPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr string
+	}{
+		{pattern: "io.bitrise.sample.*"},
+		{pattern: "*ParserTest.parses empty input"},
+		{pattern: "io.bitrise.sample.ParserTest$Nested"},
+		{pattern: `io.bitrise.sample.ParserTest.parses[0: "1*5"]`},
+		{pattern: "io.bitrise.sample.ParserTest.1 plus 1 is 2"},
+		{pattern: "*"},
+		{pattern: " ", wantErr: "empty pattern"},
+		{pattern: "io.bitrise.sample.ParserTest.parses\ninput", wantErr: `pattern "io.bitrise.sample.ParserTest.parses\ninput" contains a control character`},
+		{pattern: "io.bitrise..ParserTest", wantErr: `pattern "io.bitrise..ParserTest" contains an empty name segment`},
+		{pattern: ".ParserTest", wantErr: `pattern ".ParserTest" contains an empty name segment`},
+		{pattern: "io.bitrise.ParserTest.", wantErr: `pattern "io.bitrise.ParserTest." contains an empty name segment`},
+		{pattern: "ParserTest..parses", wantErr: `pattern "ParserTest..parses" contains an empty name segment`},
+		{pattern: `io.bit"rise.ParserTest`, wantErr: `pattern "io.bit\"rise.ParserTest" contains an invalid package or class name: bit"rise`},
+		{pattern: "io.bitrise.1sample.ParserTest", wantErr: `pattern "io.bitrise.1sample.ParserTest" contains an invalid package or class name: 1sample`},
+		{pattern: "io.bitrise.sample ParserTest.parses", wantErr: `pattern "io.bitrise.sample ParserTest.parses" contains an invalid package or class name: sample ParserTest`},
+		{pattern: "io.bitrise.ParserTest. parses", wantErr: `pattern "io.bitrise.ParserTest. parses" contains an invalid class or test name:  parses`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := ValidateTestPattern(tt.pattern)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_kotlinStringLiteral(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "io.bitrise.sample.ParserTest.parses empty input", want: `"io.bitrise.sample.ParserTest.parses empty input"`},
+		{value: "io.bitrise.sample.ParserTest$Nested", want: `"io.bitrise.sample.ParserTest\$Nested"`},
+		{value: "io.bitrise.sample.ParserTest.formats ${amount} as price", want: `"io.bitrise.sample.ParserTest.formats \${amount} as price"`},
+		{value: `io.bitrise.sample.ParserTest.parses[0: "1*5"]`, want: `"io.bitrise.sample.ParserTest.parses[0: \"1*5\"]"`},
+		{value: `C:\Users\bitrise\shards.txt`, want: `"C:\\Users\\bitrise\\shards.txt"`},
+		{value: "line\tbreak\n\x00", want: `"line\tbreak\n\u0000"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			require.Equal(t, tt.want, kotlinStringLiteral(tt.value))
+		})
+	}
+}
+
+func Test_generateTestFilterGradleInitScriptContent_escaping(t *testing.T) {
+	got, err := generateTestFilterGradleInitScriptContent(nil, []TestPattern{
+		{Pattern: "io.bitrise.sample.ParserTest$Nested.parsesNestedValue", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "io.bitrise.sample.ParserTest.formats ${amount} as price"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, got, `if (bitriseTestSuiteName in setOf("app-debug")) filter.excludeTestsMatching("io.bitrise.sample.ParserTest\$Nested.parsesNestedValue")`)
+	require.Contains(t, got, `filter.excludeTestsMatching("io.bitrise.sample.ParserTest.formats \${amount} as price")`)
+}
@@ -4,38 +4,168 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/bitrise-io/go-utils/v2/fileutil"
 	"github.com/bitrise-io/go-utils/v2/pathutil"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
 )
 
 const (
-	testSkippingGradleInitScriptTemplateText = `allprojects {
+	// Included test patterns are applied to every Test task, even to the ones without matching tests,
+	// so failing on no matching tests is disabled when included tests are set.
+	// The test suite name of the local unit test tasks follows the <module>-<variant> naming of the test addon export,
+	// where the module is the name of the build directory's parent directory (the directory above <build dir>/test-results).
+	// If every included test pattern is scoped to test suites, the Test tasks of other test suites are disabled,
+	// as they would run every test without an include pattern.
+	// The quarantined test run ignores test failures and writes its results next to the regular ones,
+	// so that they are not picked up by the result and report path patterns.
+	testFilterGradleInitScriptTemplateText = `allprojects {
     tasks.withType<Test>().configureEach {
+        {{- if .HasScopedTests }}
+        val bitriseTestSuiteName = if (name.startsWith("test") && name.endsWith("UnitTest")) {
+            project.layout.buildDirectory.get().asFile.parentFile.name + "-" + name.removePrefix("test").removeSuffix("UnitTest").replaceFirstChar { it.lowercase() }
+        } else {
+            ""
+        }
+        {{- end }}
+        {{- if .IncludedTests }}
+        filter.isFailOnNoMatchingTests = false
+        {{- end }}
+        {{- if .OnlyScopedIncludedTests }}
+        var bitriseHasIncludedTests = false
+        {{- end }}
+        {{- range .IncludedTests }}
+        {{- if and .TestSuiteNames $.OnlyScopedIncludedTests }}
+        if (bitriseTestSuiteName in setOf({{ testSuiteNames .TestSuiteNames }})) {
+            filter.includeTestsMatching({{ kotlin .Pattern }})
+            bitriseHasIncludedTests = true
+        }
+        {{- else if .TestSuiteNames }}
+        if (bitriseTestSuiteName in setOf({{ testSuiteNames .TestSuiteNames }})) filter.includeTestsMatching({{ kotlin .Pattern }})
+        {{- else }}
+        filter.includeTestsMatching({{ kotlin .Pattern }})
+        {{- end }}
+        {{- end }}
+        {{- if .OnlyScopedIncludedTests }}
+        if (!bitriseHasIncludedTests) {
+            enabled = false
+        }
+        {{- end }}
+        {{- if .QuarantinedRun }}
+        ignoreFailures = true
+        reports.junitXml.outputLocation.set(project.layout.buildDirectory.dir({{ kotlin .QuarantinedResultsDir }} + "/" + name))
+        reports.html.outputLocation.set(project.layout.buildDirectory.dir({{ kotlin .QuarantinedReportsDir }} + "/" + name))
+        {{- end }}
         {{- range .ExcludedTests }}
-        filter.excludeTestsMatching("{{ . }}")
+        {{- if .TestSuiteNames }}
+        if (bitriseTestSuiteName in setOf({{ testSuiteNames .TestSuiteNames }})) filter.excludeTestsMatching({{ kotlin .Pattern }})
+        {{- else }}
+        filter.excludeTestsMatching({{ kotlin .Pattern }})
+        {{- end }}
         {{- end }}
     }
 }`
+
+	// The shard assignments are read from a separate file, as a huge collection literal
+	// could exceed the JVM method size limit when the init script is compiled.
+	testShardingGradleInitScriptTemplateText = `val bitriseShardIndex = {{ .ShardIndex }}
+val bitriseShardCount = {{ .ShardCount }}
+val bitriseShardAssignments = File({{ kotlin .AssignmentsPath }}).readLines()
+    .filter { it.isNotBlank() }
+    .associate { line ->
+        val (shard, className) = line.split(" ", limit = 2)
+        className to shard.toInt()
+    }
+
+allprojects {
+    tasks.withType<Test>().configureEach {
+        exclude { element ->
+            if (element.isDirectory || !element.name.endsWith(".class")) {
+                return@exclude false
+            }
+
+            val className = element.path.removeSuffix(".class").replace('/', '.').substringBefore('$')
+            val shard = bitriseShardAssignments[className] ?: Math.floorMod(className.hashCode(), bitriseShardCount)
+            shard != bitriseShardIndex
+        }
+    }
+}`
+
+	// ProjectDependency.getDependencyProject() is removed in Gradle 9, while its replacement (getPath()) is only available since Gradle 8.11.
+	// The build types of the Android projects are read through reflection, as the Android Gradle Plugin is not on the init script's classpath.
+	// The graph is written to a file, so that it can be collected while Gradle lists the tasks of the build.
+	projectGraphGradleInitScriptTemplateText = `fun bitriseDependencyPath(dependency: ProjectDependency): String {
+    val getPath = dependency.javaClass.methods.firstOrNull { it.name == "getPath" && it.parameterCount == 0 }
+    if (getPath != null) {
+        return getPath.invoke(dependency) as String
+    }
+    return (dependency.javaClass.getMethod("getDependencyProject").invoke(dependency) as Project).path
+}
+
+fun bitriseBuildTypes(project: Project): List<String> {
+    val android = project.extensions.findByName("android") ?: return emptyList()
+    val getBuildTypes = android.javaClass.methods.firstOrNull { it.name == "getBuildTypes" && it.parameterCount == 0 } ?: return emptyList()
+    val buildTypes = getBuildTypes.invoke(android) as? org.gradle.api.NamedDomainObjectCollection<*> ?: return emptyList()
+    return buildTypes.names.toList()
+}
+
+gradle.projectsEvaluated {
+    val bitriseGraph = mutableListOf<String>()
+    rootProject.allprojects.forEach { project ->
+        bitriseGraph.add("bitrise-project|${project.path}|${project.projectDir.absolutePath}")
+        bitriseGraph.add("bitrise-build-dir|${project.path}|${project.layout.buildDirectory.get().asFile.absolutePath}")
+        bitriseBuildTypes(project).forEach { buildType ->
+            bitriseGraph.add("bitrise-build-type|${project.path}|$buildType")
+        }
+        project.configurations.forEach { configuration ->
+            configuration.dependencies.withType(ProjectDependency::class.java).forEach { dependency ->
+                bitriseGraph.add("bitrise-dependency|${project.path}|${bitriseDependencyPath(dependency)}")
+            }
+        }
+    }
+    java.io.File({{ kotlin .OutputPath }}).writeText(bitriseGraph.joinToString("\n"))
+}`
 )
 
-type skipTestingTemplateData struct {
-	ExcludedTests []string
+type testFilterTemplateData struct {
+	IncludedTests           []TestPattern
+	ExcludedTests           []TestPattern
+	HasScopedTests          bool
+	OnlyScopedIncludedTests bool
+
+	QuarantinedRun        bool
+	QuarantinedResultsDir string
+	QuarantinedReportsDir string
+}
+
+type testShardingTemplateData struct {
+	ShardIndex      int
+	ShardCount      int
+	AssignmentsPath string
 }
 
-func WriteSkipTestingInitScript(skipTesting []string) (string, error) {
+// WriteTestFilterInitScript writes a Gradle init script, which limits every Test task to the included test patterns
+// (if any) and excludes the excluded test patterns.
+func WriteTestFilterInitScript(includedTests, excludedTests []TestPattern) (string, error) {
+	if err := validateTestPatterns(append(slices.Clone(includedTests), excludedTests...)); err != nil {
+		return "", err
+	}
+
 	tmpDir, er := pathutil.NewPathProvider().CreateTempDir("gradle")
 	if er != nil {
 		return "", fmt.Errorf("create temp dir for Gradle init script: %w", er)
 	}
 
-	initScriptContent, err := generateTestSkippingGradleInitScriptContent(skipTesting)
+	initScriptContent, err := generateTestFilterGradleInitScriptContent(includedTests, excludedTests)
 	if err != nil {
 		return "", fmt.Errorf("generate Gradle init script content: %w", err)
 	}
 
-	initGradlePath := filepath.Join(tmpDir, "bitrise-test-skipping.init.gradle.kts")
+	initGradlePath := filepath.Join(tmpDir, "bitrise-test-filter.init.gradle.kts")
 	err = fileutil.NewFileManager().Write(initGradlePath, initScriptContent, 0o755)
 	if err != nil {
 		return "", fmt.Errorf("write Gradle init script (%s): %w", initGradlePath, err)
@@ -44,17 +174,186 @@ func WriteSkipTestingInitScript(skipTesting []string) (string, error) {
 	return initGradlePath, nil
 }
 
-func generateTestSkippingGradleInitScriptContent(skipTesting []string) (string, error) {
-	tmpl, err := template.New("bitrise-test-skipping.init.gradle.kts").Parse(testSkippingGradleInitScriptTemplateText)
+func generateTestFilterGradleInitScriptContent(includedTests, excludedTests []TestPattern) (string, error) {
+	return executeTestFilterTemplate(testFilterTemplateData{
+		IncludedTests:  includedTests,
+		ExcludedTests:  excludedTests,
+		HasScopedTests: hasScopedTests(includedTests, excludedTests),
+	})
+}
+
+// WriteQuarantinedTestsInitScript writes a Gradle init script, which limits every Test task to the quarantined tests,
+// ignores their failures and writes their XML results into the <module>/build/quarantined-test-results directory
+// and HTML reports into the <module>/build/reports/quarantined-tests directory.
+func WriteQuarantinedTestsInitScript(quarantinedTests []TestPattern) (string, error) {
+	if err := validateTestPatterns(quarantinedTests); err != nil {
+		return "", err
+	}
+
+	initScriptContent, err := generateQuarantinedTestsGradleInitScriptContent(quarantinedTests)
+	if err != nil {
+		return "", fmt.Errorf("generate Gradle init script content: %w", err)
+	}
+
+	return writeInitScript("bitrise-quarantined-tests.init.gradle.kts", initScriptContent)
+}
+
+func generateQuarantinedTestsGradleInitScriptContent(quarantinedTests []TestPattern) (string, error) {
+	return executeTestFilterTemplate(testFilterTemplateData{
+		IncludedTests:         quarantinedTests,
+		HasScopedTests:        hasScopedTests(quarantinedTests, nil),
+		QuarantinedRun:        true,
+		QuarantinedResultsDir: testaddon.QuarantinedTestResultsDirName,
+		QuarantinedReportsDir: "reports/quarantined-tests",
+	})
+}
+
+func executeTestFilterTemplate(templateData testFilterTemplateData) (string, error) {
+	tmpl, err := template.New("bitrise-test-filter.init.gradle.kts").Funcs(template.FuncMap{
+		"kotlin":         kotlinStringLiteral,
+		"testSuiteNames": kotlinStringList,
+	}).Parse(testFilterGradleInitScriptTemplateText)
 	if err != nil {
 		return "", err
 	}
 
+	templateData.OnlyScopedIncludedTests = len(templateData.IncludedTests) > 0 && !slices.ContainsFunc(templateData.IncludedTests, func(pattern TestPattern) bool {
+		return len(pattern.TestSuiteNames) == 0
+	})
+
 	resultBuffer := bytes.Buffer{}
-	templateData := skipTestingTemplateData{ExcludedTests: skipTesting}
 	if err := tmpl.Execute(&resultBuffer, templateData); err != nil {
 		return "", err
 	}
 
 	return resultBuffer.String(), nil
 }
+
+func hasScopedTests(includedTests, excludedTests []TestPattern) bool {
+	for _, pattern := range append(slices.Clone(includedTests), excludedTests...) {
+		if len(pattern.TestSuiteNames) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteShardingInitScript writes a Gradle init script, which limits every Test task to the test classes of the given shard.
+// The assignments map test class names to shard indexes, classes missing from it are assigned by their name's hash code.
+func WriteShardingInitScript(shardIndex, shardCount int, assignments map[string]int) (string, error) {
+	tmpDir, err := pathutil.NewPathProvider().CreateTempDir("gradle")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir for Gradle init script: %w", err)
+	}
+
+	assignmentsPath := filepath.Join(tmpDir, "bitrise-test-sharding.txt")
+	if err := fileutil.NewFileManager().Write(assignmentsPath, generateShardAssignmentsContent(assignments), 0o644); err != nil {
+		return "", fmt.Errorf("write test shard assignments (%s): %w", assignmentsPath, err)
+	}
+
+	initScriptContent, err := generateTestShardingGradleInitScriptContent(shardIndex, shardCount, assignmentsPath)
+	if err != nil {
+		return "", fmt.Errorf("generate Gradle init script content: %w", err)
+	}
+
+	initGradlePath := filepath.Join(tmpDir, "bitrise-test-sharding.init.gradle.kts")
+	if err := fileutil.NewFileManager().Write(initGradlePath, initScriptContent, 0o755); err != nil {
+		return "", fmt.Errorf("write Gradle init script (%s): %w", initGradlePath, err)
+	}
+
+	return initGradlePath, nil
+}
+
+func generateShardAssignmentsContent(assignments map[string]int) string {
+	classNames := make([]string, 0, len(assignments))
+	for className := range assignments {
+		classNames = append(classNames, className)
+	}
+	sort.Strings(classNames)
+
+	var content strings.Builder
+	for _, className := range classNames {
+		content.WriteString(fmt.Sprintf("%d %s\n", assignments[className], className))
+	}
+	return content.String()
+}
+
+func generateTestShardingGradleInitScriptContent(shardIndex, shardCount int, assignmentsPath string) (string, error) {
+	tmpl, err := template.New("bitrise-test-sharding.init.gradle.kts").Funcs(template.FuncMap{
+		"kotlin": kotlinStringLiteral,
+	}).Parse(testShardingGradleInitScriptTemplateText)
+	if err != nil {
+		return "", err
+	}
+
+	resultBuffer := bytes.Buffer{}
+	templateData := testShardingTemplateData{
+		ShardIndex:      shardIndex,
+		ShardCount:      shardCount,
+		AssignmentsPath: assignmentsPath,
+	}
+	if err := tmpl.Execute(&resultBuffer, templateData); err != nil {
+		return "", err
+	}
+
+	return resultBuffer.String(), nil
+}
+
+// ProjectGraphFileName is the name of the file, which the project graph init script writes next to itself.
+const ProjectGraphFileName = "project-graph.txt"
+
+type projectGraphTemplateData struct {
+	OutputPath string
+}
+
+// WriteProjectGraphInitScript writes a Gradle init script, which writes the project directories, build directories,
+// Android build types and project dependencies of the build into the ProjectGraphFileName file next to the init script,
+// once every project is evaluated.
+func WriteProjectGraphInitScript() (string, error) {
+	tmpDir, err := pathutil.NewPathProvider().CreateTempDir("gradle")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir for Gradle init script: %w", err)
+	}
+
+	initScriptContent, err := generateProjectGraphGradleInitScriptContent(filepath.Join(tmpDir, ProjectGraphFileName))
+	if err != nil {
+		return "", fmt.Errorf("generate Gradle init script content: %w", err)
+	}
+
+	initGradlePath := filepath.Join(tmpDir, "bitrise-project-graph.init.gradle.kts")
+	if err := fileutil.NewFileManager().Write(initGradlePath, initScriptContent, 0o755); err != nil {
+		return "", fmt.Errorf("write Gradle init script (%s): %w", initGradlePath, err)
+	}
+
+	return initGradlePath, nil
+}
+
+func generateProjectGraphGradleInitScriptContent(outputPth string) (string, error) {
+	tmpl, err := template.New("bitrise-project-graph.init.gradle.kts").Funcs(template.FuncMap{
+		"kotlin": kotlinStringLiteral,
+	}).Parse(projectGraphGradleInitScriptTemplateText)
+	if err != nil {
+		return "", err
+	}
+
+	resultBuffer := bytes.Buffer{}
+	if err := tmpl.Execute(&resultBuffer, projectGraphTemplateData{OutputPath: outputPth}); err != nil {
+		return "", err
+	}
+
+	return resultBuffer.String(), nil
+}
+
+func writeInitScript(fileName, content string) (string, error) {
+	tmpDir, err := pathutil.NewPathProvider().CreateTempDir("gradle")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir for Gradle init script: %w", err)
+	}
+
+	initGradlePath := filepath.Join(tmpDir, fileName)
+	if err := fileutil.NewFileManager().Write(initGradlePath, content, 0o755); err != nil {
+		return "", fmt.Errorf("write Gradle init script (%s): %w", initGradlePath, err)
+	}
+
+	return initGradlePath, nil
+}
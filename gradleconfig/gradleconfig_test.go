@@ -0,0 +1,15 @@
+package gradleconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_generateProjectGraphGradleInitScriptContent(t *testing.T) {
+	got, err := generateProjectGraphGradleInitScriptContent("/tmp/gradle/project-graph.txt")
+	require.NoError(t, err)
+	require.Contains(t, got, `bitriseGraph.add("bitrise-build-dir|${project.path}|${project.layout.buildDirectory.get().asFile.absolutePath}")`)
+	require.Contains(t, got, `bitriseGraph.add("bitrise-build-type|${project.path}|$buildType")`)
+	require.Contains(t, got, `java.io.File("/tmp/gradle/project-graph.txt").writeText(bitriseGraph.joinToString("\n"))`)
+}
@@ -0,0 +1,45 @@
+package gradleconfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitInitScriptArgs separates the init scripts from the rest of the Gradle arguments.
+// Every spelling Gradle accepts is recognized: --init-script <path>, --init-script=<path>, -I <path> and -I<path>.
+func SplitInitScriptArgs(args []string) ([]string, []string, error) {
+	var initScripts, otherArgs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--init-script" || arg == "-I":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, nil, fmt.Errorf("missing init script path after %s", arg)
+			}
+			initScripts = append(initScripts, args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--init-script="):
+			pth := strings.TrimPrefix(arg, "--init-script=")
+			if pth == "" {
+				return nil, nil, fmt.Errorf("missing init script path in %s", arg)
+			}
+			initScripts = append(initScripts, pth)
+		case strings.HasPrefix(arg, "-I"):
+			initScripts = append(initScripts, strings.TrimPrefix(arg, "-I"))
+		default:
+			otherArgs = append(otherArgs, arg)
+		}
+	}
+
+	return initScripts, otherArgs, nil
+}
+
+// InitScriptArgs returns the Gradle arguments applying the init scripts in the given order.
+func InitScriptArgs(initScripts []string) []string {
+	var args []string
+	for _, initScript := range initScripts {
+		args = append(args, "--init-script", initScript)
+	}
+	return args
+}
@@ -0,0 +1,58 @@
+package gradleconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitInitScriptArgs(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		wantInitScripts []string
+		wantOtherArgs   []string
+		wantErr         string
+	}{
+		{
+			name:          "No init scripts",
+			args:          []string{"--info", "-Pci=true"},
+			wantOtherArgs: []string{"--info", "-Pci=true"},
+		},
+		{
+			name:            "Every spelling",
+			args:            []string{"--init-script", "cache.gradle", "--info", "--init-script=repos.gradle.kts", "-I", "mirror.gradle", "-I/tmp/ci.gradle"},
+			wantInitScripts: []string{"cache.gradle", "repos.gradle.kts", "mirror.gradle", "/tmp/ci.gradle"},
+			wantOtherArgs:   []string{"--info"},
+		},
+		{
+			name:          "Similar arguments are kept",
+			args:          []string{"-i", "--include-build", "build-logic", "-Dinit-script=false"},
+			wantOtherArgs: []string{"-i", "--include-build", "build-logic", "-Dinit-script=false"},
+		},
+		{
+			name:    "Missing path",
+			args:    []string{"--info", "-I"},
+			wantErr: "missing init script path after -I",
+		},
+		{
+			name:    "Missing path after equal sign",
+			args:    []string{"--init-script="},
+			wantErr: "missing init script path in --init-script=",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initScripts, otherArgs, err := SplitInitScriptArgs(tt.args)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantInitScripts, initScripts)
+			require.Equal(t, tt.wantOtherArgs, otherArgs)
+		})
+	}
+
+	require.Equal(t, []string{"--init-script", "cache.gradle", "--init-script", "/tmp/ci.gradle"}, InitScriptArgs([]string{"cache.gradle", "/tmp/ci.gradle"}))
+}
@@ -0,0 +1,158 @@
+package gradleconfig
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var parameterizedSuffixRegexp = regexp.MustCompile(`\[[^\]]*\]$`)
+
+// TestPattern is a Gradle test filter pattern, optionally scoped to test suites.
+type TestPattern struct {
+	Pattern string
+	// TestSuiteNames limits the pattern to the local unit test tasks of the given test suites,
+	// named as <module>-<variant> (the naming of the test addon export, for example app-debug).
+	// The pattern applies to every Test task if no test suite name is set.
+	TestSuiteNames []string
+}
+
+// ParseTestPatterns parses the newline separated Gradle test filter patterns, empty lines are ignored.
+func ParseTestPatterns(input string) []TestPattern {
+	var patterns []TestPattern
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			patterns = append(patterns, TestPattern{Pattern: line})
+		}
+	}
+	return patterns
+}
+
+// AppliesToTestSuite checks if the pattern applies to the test suite (<module>-<variant>):
+// unscoped patterns apply to every test suite, scoped patterns only to the listed ones.
+func AppliesToTestSuite(pattern TestPattern, testSuiteName string) bool {
+	return len(pattern.TestSuiteNames) == 0 || slices.Contains(pattern.TestSuiteNames, testSuiteName)
+}
+
+// NarrowTestPatterns limits the patterns to the tests selected by the filters as well, keeping the test suites of the patterns.
+// Gradle ORs the include patterns of a Test task, so the intersection is computed here: a pattern is kept if a filter
+// selects every test of it, and replaced by the filter if the pattern selects every test of the filter.
+// Patterns which overlap a filter only partially are dropped. Without filters, the patterns are returned unchanged.
+func NarrowTestPatterns(patterns, filters []TestPattern) []TestPattern {
+	if len(filters) == 0 {
+		return patterns
+	}
+
+	var narrowed []TestPattern
+	for _, pattern := range patterns {
+		for _, filter := range filters {
+			var narrowedPattern string
+			switch {
+			case coversTestPattern(filter.Pattern, pattern.Pattern):
+				narrowedPattern = pattern.Pattern
+			case coversTestPattern(pattern.Pattern, filter.Pattern):
+				narrowedPattern = filter.Pattern
+			default:
+				continue
+			}
+
+			if !slices.ContainsFunc(narrowed, func(p TestPattern) bool {
+				return p.Pattern == narrowedPattern && slices.Equal(p.TestSuiteNames, pattern.TestSuiteNames)
+			}) {
+				narrowed = append(narrowed, TestPattern{Pattern: narrowedPattern, TestSuiteNames: pattern.TestSuiteNames})
+			}
+		}
+	}
+	return narrowed
+}
+
+// coversTestPattern checks if the outer pattern selects every test of the inner pattern,
+// the wildcards of the inner pattern are matched as any other character.
+func coversTestPattern(outer, inner string) bool {
+	if MatchesTestPattern(outer, inner, "") {
+		return true
+	}
+	if i := strings.LastIndex(inner, "."); i != -1 {
+		return MatchesTestPattern(outer, inner[:i], inner[i+1:])
+	}
+	return false
+}
+
+// MatchesTestPattern mimics how Gradle's test filter matches a test case against an include/exclude pattern.
+//
+// The pattern can be a fully qualified class name, a class name followed by a test method name, or either of these
+// with '*' wildcards. Patterns starting with an uppercase letter are matched against the simple class name as well.
+// Parameterized test cases are matched by their method name, without the invocation index and JUnit 5 signature.
+func MatchesTestPattern(pattern, className, testName string) bool {
+	re := testPatternRegexp(pattern)
+
+	classNames := []string{className}
+	if startsWithUpper(pattern) {
+		if i := strings.LastIndex(className, "."); i != -1 {
+			classNames = append(classNames, className[i+1:])
+		}
+	}
+
+	testNames := []string{testName}
+	if trimmed := parameterizedSuffixRegexp.ReplaceAllString(testName, ""); trimmed != testName {
+		testNames = append(testNames, trimmed)
+	}
+	if match := junit5SignatureRegexp.FindStringSubmatch(testName); match != nil {
+		testNames = append(testNames, match[1])
+	}
+
+	for _, class := range classNames {
+		if re.MatchString(class) {
+			return true
+		}
+		for _, name := range testNames {
+			if re.MatchString(class + "." + name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func testPatternRegexp(pattern string) *regexp.Regexp {
+	return GlobRegexp(pattern, false)
+}
+
+// GlobRegexp compiles the glob pattern to a regexp matching the whole input, where '*' matches any sequence of characters.
+// Every pattern compiles, as the literal parts are quoted.
+func GlobRegexp(pattern string, ignoreCase bool) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	expr := "^" + strings.Join(parts, ".*") + "$"
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.MustCompile(expr)
+}
+
+func startsWithUpper(s string) bool {
+	for _, r := range s {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// MatchesTestClass checks if the pattern selects the class or any of its test methods.
+func MatchesTestClass(pattern, className string) bool {
+	if MatchesTestPattern(pattern, className, "") {
+		return true
+	}
+
+	// com.acme.ParserTest.parses* selects test methods of com.acme.ParserTest.
+	if i := strings.LastIndex(pattern, "."); i != -1 {
+		return MatchesTestPattern(pattern[:i], className, "")
+	}
+
+	return false
+}
@@ -0,0 +1,174 @@
+package gradleconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTestPatterns(t *testing.T) {
+	got := ParseTestPatterns("com.acme.payments.*\n\n  com.acme.CheckoutTest.paysWithCard  \n")
+	require.Equal(t, []TestPattern{{Pattern: "com.acme.payments.*"}, {Pattern: "com.acme.CheckoutTest.paysWithCard"}}, got)
+
+	require.Nil(t, ParseTestPatterns(""))
+}
+
+func TestMatchesTestPattern(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		className string
+		testName  string
+		want      bool
+	}{
+		{pattern: "com.acme.payments.CheckoutTest", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: true},
+		{pattern: "com.acme.payments.CheckoutTest.paysWithCard", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: true},
+		{pattern: "com.acme.payments.CheckoutTest.paysWithCash", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: false},
+		{pattern: "com.acme.payments.*", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: true},
+		{pattern: "com.acme.payments.*", className: "com.acme.paymentsv2.CheckoutTest", testName: "paysWithCard", want: false},
+		{pattern: "*CheckoutTest.pays*", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: true},
+		{pattern: "CheckoutTest", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: true},
+		{pattern: "CheckoutTest.paysWithCard", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: true},
+		{pattern: "payments.CheckoutTest", className: "com.acme.payments.CheckoutTest", testName: "paysWithCard", want: false},
+		{pattern: "com.acme.ParserTest.parses", className: "com.acme.ParserTest", testName: "parses[1]", want: true},
+		{pattern: "com.acme.ParserTest.parses[1]", className: "com.acme.ParserTest", testName: "parses[1]", want: true},
+		{pattern: "com.acme.ParserTest.parses[2]", className: "com.acme.ParserTest", testName: "parses[1]", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			require.Equal(t, tt.want, MatchesTestPattern(tt.pattern, tt.className, tt.testName))
+		})
+	}
+}
+
+func Test_generateTestFilterGradleInitScriptContent(t *testing.T) {
+	got, err := generateTestFilterGradleInitScriptContent([]TestPattern{{Pattern: "com.acme.payments.*"}}, []TestPattern{{Pattern: "com.acme.payments.CheckoutTest.paysWithCash"}})
+	require.NoError(t, err)
+	require.Equal(t, `allprojects {
+    tasks.withType<Test>().configureEach {
+        filter.isFailOnNoMatchingTests = false
+        filter.includeTestsMatching("com.acme.payments.*")
+        filter.excludeTestsMatching("com.acme.payments.CheckoutTest.paysWithCash")
+    }
+}`, got)
+
+	got, err = generateTestFilterGradleInitScriptContent(nil, []TestPattern{{Pattern: "com.acme.payments.CheckoutTest.paysWithCash"}})
+	require.NoError(t, err)
+	require.Equal(t, `allprojects {
+    tasks.withType<Test>().configureEach {
+        filter.excludeTestsMatching("com.acme.payments.CheckoutTest.paysWithCash")
+    }
+}`, got)
+
+	got, err = generateTestFilterGradleInitScriptContent(nil, []TestPattern{
+		{Pattern: "com.acme.payments.CheckoutTest.paysWithCash", TestSuiteNames: []string{"app-debug", "app-freeRelease"}},
+		{Pattern: "com.acme.ParserTest.parses"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `allprojects {
+    tasks.withType<Test>().configureEach {
+        val bitriseTestSuiteName = if (name.startsWith("test") && name.endsWith("UnitTest")) {
+            project.layout.buildDirectory.get().asFile.parentFile.name + "-" + name.removePrefix("test").removeSuffix("UnitTest").replaceFirstChar { it.lowercase() }
+        } else {
+            ""
+        }
+        if (bitriseTestSuiteName in setOf("app-debug", "app-freeRelease")) filter.excludeTestsMatching("com.acme.payments.CheckoutTest.paysWithCash")
+        filter.excludeTestsMatching("com.acme.ParserTest.parses")
+    }
+}`, got)
+}
+
+func TestMatchesTestClass(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		className string
+		want      bool
+	}{
+		{pattern: "com.acme.payments.CheckoutTest", className: "com.acme.payments.CheckoutTest", want: true},
+		{pattern: "com.acme.payments.CheckoutTest.paysWithCard", className: "com.acme.payments.CheckoutTest", want: true},
+		{pattern: "com.acme.payments.CheckoutTest.pays*", className: "com.acme.payments.CheckoutTest", want: true},
+		{pattern: "com.acme.payments.*", className: "com.acme.payments.CheckoutTest", want: true},
+		{pattern: "com.acme.ParserTest$Nested.parsesNestedValue", className: "com.acme.ParserTest$Nested", want: true},
+		{pattern: "com.acme.payments.CheckoutTest.paysWithCard", className: "com.acme.payments.RefundTest", want: false},
+		{pattern: "com.acme.payments.RemovedTest", className: "com.acme.payments.CheckoutTest", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			require.Equal(t, tt.want, MatchesTestClass(tt.pattern, tt.className))
+		})
+	}
+}
+
+func TestNarrowTestPatterns(t *testing.T) {
+	patterns := []TestPattern{
+		{Pattern: "com.acme.payments.CheckoutTest.paysWithCash", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "com.acme.ParserTest"},
+		{Pattern: "com.acme.FormatterTest.formats*"},
+		{Pattern: "com.acme.ClockTest"},
+	}
+
+	require.Equal(t, patterns, NarrowTestPatterns(patterns, nil))
+	require.Equal(t, []TestPattern{
+		// Selected by the filter as a whole.
+		{Pattern: "com.acme.payments.CheckoutTest.paysWithCash", TestSuiteNames: []string{"app-debug"}},
+		// Narrowed to the filter.
+		{Pattern: "com.acme.ParserTest.parsesDecimal"},
+		{Pattern: "com.acme.FormatterTest.formatsPrice"},
+	}, NarrowTestPatterns(patterns, ParseTestPatterns("com.acme.payments.*\ncom.acme.ParserTest.parsesDecimal\ncom.acme.FormatterTest.formatsPrice")))
+}
+
+func Test_generateQuarantinedTestsGradleInitScriptContent(t *testing.T) {
+	got, err := generateQuarantinedTestsGradleInitScriptContent([]TestPattern{
+		{Pattern: "com.acme.payments.CheckoutTest.paysWithCash", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "com.acme.ParserTest"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `allprojects {
+    tasks.withType<Test>().configureEach {
+        val bitriseTestSuiteName = if (name.startsWith("test") && name.endsWith("UnitTest")) {
+            project.layout.buildDirectory.get().asFile.parentFile.name + "-" + name.removePrefix("test").removeSuffix("UnitTest").replaceFirstChar { it.lowercase() }
+        } else {
+            ""
+        }
+        filter.isFailOnNoMatchingTests = false
+        if (bitriseTestSuiteName in setOf("app-debug")) filter.includeTestsMatching("com.acme.payments.CheckoutTest.paysWithCash")
+        filter.includeTestsMatching("com.acme.ParserTest")
+        ignoreFailures = true
+        reports.junitXml.outputLocation.set(project.layout.buildDirectory.dir("quarantined-test-results" + "/" + name))
+        reports.html.outputLocation.set(project.layout.buildDirectory.dir("reports/quarantined-tests" + "/" + name))
+    }
+}`, got)
+
+	got, err = generateQuarantinedTestsGradleInitScriptContent([]TestPattern{
+		{Pattern: "com.acme.payments.CheckoutTest.paysWithCash", TestSuiteNames: []string{"app-debug"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `allprojects {
+    tasks.withType<Test>().configureEach {
+        val bitriseTestSuiteName = if (name.startsWith("test") && name.endsWith("UnitTest")) {
+            project.layout.buildDirectory.get().asFile.parentFile.name + "-" + name.removePrefix("test").removeSuffix("UnitTest").replaceFirstChar { it.lowercase() }
+        } else {
+            ""
+        }
+        filter.isFailOnNoMatchingTests = false
+        var bitriseHasIncludedTests = false
+        if (bitriseTestSuiteName in setOf("app-debug")) {
+            filter.includeTestsMatching("com.acme.payments.CheckoutTest.paysWithCash")
+            bitriseHasIncludedTests = true
+        }
+        if (!bitriseHasIncludedTests) {
+            enabled = false
+        }
+        ignoreFailures = true
+        reports.junitXml.outputLocation.set(project.layout.buildDirectory.dir("quarantined-test-results" + "/" + name))
+        reports.html.outputLocation.set(project.layout.buildDirectory.dir("reports/quarantined-tests" + "/" + name))
+    }
+}`, got)
+}
+
+func TestGlobRegexp(t *testing.T) {
+	require.True(t, GlobRegexp("feature:*", false).MatchString("feature:login"))
+	require.False(t, GlobRegexp("feature:*", false).MatchString("app"))
+	require.False(t, GlobRegexp("a.b", false).MatchString("axb"))
+	require.False(t, GlobRegexp("Release", false).MatchString("release"))
+	require.True(t, GlobRegexp("Release", true).MatchString("release"))
+}
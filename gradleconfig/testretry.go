@@ -0,0 +1,130 @@
+package gradleconfig
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// The plugin is applied by its class, as the plugins {} block is not available in init scripts.
+// Every execution of a retried test is reported as a separate testcase element in the JUnit XML results.
+const testRetryPluginGradleInitScriptTemplateText = `initscript {
+    repositories {
+        {{- if .Repository }}
+        maven { url = {{ .Repository }} }
+        {{- else }}
+        gradlePluginPortal()
+        {{- end }}
+    }
+    dependencies {
+        classpath({{ kotlin .Dependency }})
+    }
+}
+
+allprojects {
+    apply<org.gradle.testretry.TestRetryPlugin>()
+
+    tasks.withType<Test>().configureEach {
+        extensions.configure<org.gradle.testretry.TestRetryTaskExtension> {
+            maxRetries.set({{ .MaxRetries }})
+            {{- if .MaxFailures }}
+            maxFailures.set({{ .MaxFailures }})
+            {{- end }}
+            failOnPassedAfterRetry.set({{ .FailOnPassedAfterRetry }})
+        }
+    }
+}`
+
+const testRetryPluginDependency = "org.gradle:test-retry-gradle-plugin"
+
+// TestRetryPluginConfig configures the Gradle test-retry plugin (org.gradle.test-retry) applied by the init script.
+type TestRetryPluginConfig struct {
+	// Version of the org.gradle:test-retry-gradle-plugin artifact.
+	Version string
+	// Repository is a local (Maven layout) repository directory or a repository URL the plugin is resolved from,
+	// the Gradle Plugin Portal is used if empty.
+	Repository string
+	// MaxRetries is the maximum number of times a failed test is retried in a Test task.
+	MaxRetries int
+	// MaxFailures disables retries if more tests failed in a Test task, 0 means no limit.
+	MaxFailures int
+	// FailOnPassedAfterRetry fails the Test task even if the failed tests passed after a retry.
+	FailOnPassedAfterRetry bool
+}
+
+type testRetryPluginTemplateData struct {
+	Repository             string
+	Dependency             string
+	MaxRetries             int
+	MaxFailures            int
+	FailOnPassedAfterRetry bool
+}
+
+// WriteTestRetryPluginInitScript writes a Gradle init script, which applies the test-retry plugin to every project
+// and configures it on every Test task.
+func WriteTestRetryPluginInitScript(config TestRetryPluginConfig) (string, error) {
+	initScriptContent, err := generateTestRetryPluginGradleInitScriptContent(config)
+	if err != nil {
+		return "", fmt.Errorf("generate Gradle init script content: %w", err)
+	}
+
+	return writeInitScript("bitrise-test-retry.init.gradle.kts", initScriptContent)
+}
+
+func generateTestRetryPluginGradleInitScriptContent(config TestRetryPluginConfig) (string, error) {
+	if config.Version == "" {
+		return "", fmt.Errorf("test-retry plugin version is not set")
+	}
+	if config.MaxRetries < 1 {
+		return "", fmt.Errorf("test-retry plugin max retries (%d) should be at least 1", config.MaxRetries)
+	}
+	if config.MaxFailures < 0 {
+		return "", fmt.Errorf("test-retry plugin max failures (%d) should not be negative", config.MaxFailures)
+	}
+
+	repository, err := kotlinRepositoryURI(config.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New("bitrise-test-retry.init.gradle.kts").Funcs(template.FuncMap{
+		"kotlin": kotlinStringLiteral,
+	}).Parse(testRetryPluginGradleInitScriptTemplateText)
+	if err != nil {
+		return "", err
+	}
+
+	resultBuffer := bytes.Buffer{}
+	templateData := testRetryPluginTemplateData{
+		Repository:             repository,
+		Dependency:             testRetryPluginDependency + ":" + config.Version,
+		MaxRetries:             config.MaxRetries,
+		MaxFailures:            config.MaxFailures,
+		FailOnPassedAfterRetry: config.FailOnPassedAfterRetry,
+	}
+	if err := tmpl.Execute(&resultBuffer, templateData); err != nil {
+		return "", err
+	}
+
+	return resultBuffer.String(), nil
+}
+
+// kotlinRepositoryURI returns the Kotlin expression of the repository's URI: repository URLs are used as they are,
+// local paths are made absolute, as init scripts are not resolved relative to the project directory.
+func kotlinRepositoryURI(repository string) (string, error) {
+	if repository == "" {
+		return "", nil
+	}
+
+	if strings.Contains(repository, "://") {
+		return fmt.Sprintf("uri(%s)", kotlinStringLiteral(repository)), nil
+	}
+
+	absRepository, err := filepath.Abs(repository)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path of the test-retry plugin repository (%s): %w", repository, err)
+	}
+	return fmt.Sprintf("File(%s).toURI()", kotlinStringLiteral(absRepository)), nil
+}
@@ -0,0 +1,55 @@
+package gradleconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_generateTestRetryPluginGradleInitScriptContent(t *testing.T) {
+	got, err := generateTestRetryPluginGradleInitScriptContent(TestRetryPluginConfig{
+		Version:     "1.6.2",
+		Repository:  "/opt/bitrise/offline-repo",
+		MaxRetries:  2,
+		MaxFailures: 10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, `initscript {
+    repositories {
+        maven { url = File("/opt/bitrise/offline-repo").toURI() }
+    }
+    dependencies {
+        classpath("org.gradle:test-retry-gradle-plugin:1.6.2")
+    }
+}
+
+allprojects {
+    apply<org.gradle.testretry.TestRetryPlugin>()
+
+    tasks.withType<Test>().configureEach {
+        extensions.configure<org.gradle.testretry.TestRetryTaskExtension> {
+            maxRetries.set(2)
+            maxFailures.set(10)
+            failOnPassedAfterRetry.set(false)
+        }
+    }
+}`, got)
+
+	got, err = generateTestRetryPluginGradleInitScriptContent(TestRetryPluginConfig{
+		Version:                "1.6.2",
+		Repository:             "https://repo.example.com/maven",
+		MaxRetries:             1,
+		FailOnPassedAfterRetry: true,
+	})
+	require.NoError(t, err)
+	require.Contains(t, got, `maven { url = uri("https://repo.example.com/maven") }`)
+	require.NotContains(t, got, "maxFailures")
+	require.Contains(t, got, "failOnPassedAfterRetry.set(true)")
+
+	got, err = generateTestRetryPluginGradleInitScriptContent(TestRetryPluginConfig{Version: "1.6.2", MaxRetries: 1})
+	require.NoError(t, err)
+	require.Contains(t, got, "gradlePluginPortal()")
+
+	_, err = generateTestRetryPluginGradleInitScriptContent(TestRetryPluginConfig{Version: "1.6.2"})
+	require.EqualError(t, err, "test-retry plugin max retries (0) should be at least 1")
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
@@ -14,8 +15,13 @@ import (
 	"github.com/bitrise-io/go-utils/v2/env"
 	"github.com/bitrise-io/go-utils/v2/log"
 	"github.com/bitrise-io/go-utils/v2/pathutil"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/affected"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/coverage"
 	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
 	"github.com/bitrise-steplib/bitrise-step-android-unit-test/output"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/retry"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/sharding"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
 	"github.com/kballard/go-shellquote"
 )
 
@@ -23,14 +29,42 @@ import (
 type Configs struct {
 	ProjectLocation string `env:"project_location,dir"`
 	Module          string `env:"module"`
+	ExcludeModules  string `env:"exclude_modules"`
 	Variant         string `env:"variant"`
+	BuildTypes      string `env:"build_types"`
+	ProductFlavors  string `env:"product_flavors"`
+	ExcludeVariants string `env:"exclude_variants"`
 	// Options
-	Arguments            string `env:"arguments"`
-	HTMLResultDirPattern string `env:"report_path_pattern"`
-	XMLResultDirPattern  string `env:"result_path_pattern"`
+	Arguments             string `env:"arguments"`
+	ChangedSince          string `env:"changed_since"`
+	TestFilter            string `env:"test_filter"`
+	MaxRetries            int    `env:"max_retries"`
+	FailureReportMaxLines int    `env:"failure_report_max_lines"`
+	HTMLResultDirPattern  string `env:"report_path_pattern"`
+	XMLResultDirPattern   string `env:"result_path_pattern"`
+	MergeTestResults      bool   `env:"merge_test_results,opt[true,false]"`
 	// Debug
-	IsDebug          bool   `env:"is_debug,opt[true,false]"`
-	QuarantinedTests string `env:"quarantined_tests"`
+	IsDebug             bool   `env:"is_debug,opt[true,false]"`
+	QuarantinedTests    string `env:"quarantined_tests"`
+	RunQuarantinedTests bool   `env:"run_quarantined_tests,opt[true,false]"`
+	// Test retry plugin
+	RetryPluginMaxRetries             int    `env:"retry_plugin_max_retries"`
+	RetryPluginMaxFailures            int    `env:"retry_plugin_max_failures"`
+	RetryPluginFailOnPassedAfterRetry bool   `env:"retry_plugin_fail_on_passed_after_retry,opt[true,false]"`
+	RetryPluginVersion                string `env:"retry_plugin_version"`
+	RetryPluginRepository             string `env:"retry_plugin_repository"`
+	// Sharding
+	ShardIndex      int    `env:"shard_index"`
+	ShardCount      int    `env:"shard_count"`
+	ShardTimingsDir string `env:"shard_timings_dir"`
+	// Flakiness history
+	FlakinessHistoryDir string  `env:"flakiness_history_dir"`
+	FlakinessThreshold  float64 `env:"flakiness_threshold,range[0..100]"`
+	// Coverage
+	Coverage                bool   `env:"coverage,opt[true,false]"`
+	CoverageThresholds      string `env:"coverage_thresholds"`
+	CoverageThresholdsFile  string `env:"coverage_thresholds_file"`
+	CoverageThresholdAction string `env:"coverage_threshold_action,opt[fail,warn]"`
 	// Defaults
 	DeployDir     string `env:"BITRISE_DEPLOY_DIR"`
 	TestResultDir string `env:"BITRISE_TEST_RESULT_DIR"`
@@ -62,6 +96,24 @@ func runStep(logger log.Logger) error {
 
 	logger.EnableDebugLog(config.IsDebug)
 
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("Process config: max_retries (%d) should not be negative", config.MaxRetries)
+	}
+	if config.FailureReportMaxLines < 0 {
+		return fmt.Errorf("Process config: failure_report_max_lines (%d) should not be negative", config.FailureReportMaxLines)
+	}
+	if config.ShardCount > 1 && (config.ShardIndex < 0 || config.ShardIndex >= config.ShardCount) {
+		return fmt.Errorf("Process config: shard_index (%d) should be between 0 and shard_count-1 (%d)", config.ShardIndex, config.ShardCount-1)
+	}
+
+	coverageRules, err := parseCoverageRules(config.CoverageThresholdsFile, config.CoverageThresholds)
+	if err != nil {
+		return fmt.Errorf("Process config: failed to parse coverage thresholds: %s", err)
+	}
+	if len(coverageRules) > 0 && !config.Coverage {
+		return fmt.Errorf("Process config: coverage thresholds are set, but coverage is not collected, set coverage to true")
+	}
+
 	gradleProject, err := gradle.NewProject(config.ProjectLocation, cmdFactory, logger)
 	if err != nil {
 		return fmt.Errorf("Process config: failed to open project: %s", err)
@@ -74,22 +126,96 @@ func runStep(logger log.Logger) error {
 		return fmt.Errorf("Process config: failed to parse arguments: %s", err)
 	}
 
+	// Init scripts from the arguments are normalized to the --init-script <path> form,
+	// the step's own init scripts are appended as additional --init-script arguments.
+	userInitScripts, args, err := gradleconfig.SplitInitScriptArgs(args)
+	if err != nil {
+		return fmt.Errorf("Process config: failed to parse init scripts from arguments: %s", err)
+	}
+	args = append(args, gradleconfig.InitScriptArgs(userInitScripts)...)
+	baseArgs := slices.Clone(args)
+
+	variantPatterns := variantPatterns{
+		BuildTypes: parseList(config.BuildTypes),
+		Flavors:    parseList(config.ProductFlavors),
+		Excluded:   parseList(config.ExcludeVariants),
+	}
+
+	testIdentifiers, err := parseQuarantinedTests(config.QuarantinedTests, logger)
+	if err != nil {
+		return fmt.Errorf("Run: failed to parse quarantined tests: %s", err)
+	}
+
 	logger.Println()
 	logger.Infof("Variants:")
 
-	variants, err := testTask.GetVariants(args...)
+	// The project graph is only listed for the inputs relying on the build types, project and build directories
+	// or project dependencies of the build, the variants of every other build are listed without the extra init script.
+	withGraph := config.ChangedSince != "" || config.ShardCount > 1 || config.Coverage || !variantPatterns.isEmpty() || hasScopedTestPatterns(testIdentifiers)
+
+	var variants gradle.Variants
+	var graph affected.Graph
+	var graphErr error
+	if withGraph {
+		variants, graph, graphErr = listVariantsWithGraph(testTask, args, logger)
+		if graphErr != nil {
+			logger.Warnf("Failed to list the project graph, build types and build directories are guessed from the variant and module names: %s", graphErr)
+		}
+	}
+	if variants == nil {
+		variants, err = testTask.GetVariants(args...)
+		if err != nil {
+			return fmt.Errorf("Run: failed to fetch variants: %s", err)
+		}
+	}
+
+	modules, err := selectModules(parseModulePatterns(config.Module), parseModulePatterns(config.ExcludeModules), variants)
 	if err != nil {
-		return fmt.Errorf("Run: failed to fetch variants: %s", err)
+		return fmt.Errorf("Run: failed to select modules: %s", err)
 	}
 
-	filteredVariants, err := filterVariants(config.Module, config.Variant, variants)
+	filteredVariants, err := filterVariants(modules, config.Variant, variants)
 	if err != nil {
 		return fmt.Errorf("Run: failed to find buildable variants: %s", err)
 	}
 
-	for module, variants := range variants {
-		logger.Printf("%s:", module)
-		for _, variant := range variants {
+	if !variantPatterns.isEmpty() {
+		filteredVariants, err = selectVariantDimensions(variantPatterns, filteredVariants, moduleBuildTypes(graph))
+		if err != nil {
+			return fmt.Errorf("Run: failed to select build types and product flavors: %s", err)
+		}
+	}
+
+	if config.ChangedSince != "" {
+		logger.Println()
+		logger.Infof("Modules affected by changes since %s:", config.ChangedSince)
+
+		if graphErr != nil {
+			return fmt.Errorf("Run: failed to find modules affected by changes: failed to read project dependency graph: %s", graphErr)
+		}
+
+		filteredVariants, err = filterAffectedVariants(config.ProjectLocation, config.ChangedSince, graph, filteredVariants, cmdFactory, logger)
+		if err != nil {
+			return fmt.Errorf("Run: failed to find modules affected by changes: %s", err)
+		}
+
+		logger.Println()
+		logger.Infof("Variants:")
+	}
+
+	var moduleNames []string
+	for module := range variants {
+		moduleNames = append(moduleNames, module)
+	}
+	slices.Sort(moduleNames)
+
+	for _, module := range moduleNames {
+		if rule := modules[module].Rule; rule != "" {
+			logger.Printf("%s: (%s)", module, rule)
+		} else {
+			logger.Printf("%s:", module)
+		}
+		for _, variant := range variants[module] {
 			if slices.Contains(filteredVariants[module], variant) {
 				logger.Donef("✓ %s", strings.TrimSuffix(variant, "UnitTest"))
 			} else {
@@ -98,55 +224,236 @@ func runStep(logger log.Logger) error {
 		}
 	}
 
-	testIdentifiers, err := parseQuarantinedTests(config.QuarantinedTests)
-	if err != nil {
-		return fmt.Errorf("Run: failed to parse quarantined tests: %s", err)
+	if len(filteredVariants) == 0 {
+		logger.Println()
+		logger.Warnf("None of the selected modules are affected by the changes since %s, skipping test run", config.ChangedSince)
+
+		// The counts are exported as zeros, so that the following steps do not read the values of a previous run.
+		logger.Println()
+		logger.Infof("Export test counts:")
+
+		if err := exporter.ExportTestCounts(nil, nil, nil, 0); err != nil {
+			logger.Warnf("Failed to export test counts: %s", err)
+		}
+		return nil
 	}
 
+	testFilters := gradleconfig.ParseTestPatterns(config.TestFilter)
+
 	var initScriptPth string
-	if len(testIdentifiers) > 0 {
-		for _, arg := range args {
-			if strings.HasPrefix(arg, "--init-script") {
-				return fmt.Errorf("Run: --init-script argument cannot be used together with quarantined_tests input")
-			} else if strings.HasPrefix(arg, "-I") {
-				return fmt.Errorf("Run: -I argument cannot be used together with quarantined_tests input")
+	if len(testFilters) > 0 || len(testIdentifiers) > 0 {
+		logger.Println()
+
+		if len(testFilters) > 0 {
+			logger.Infof("%d test filter pattern(s) found", len(testFilters))
+		}
+
+		if len(testIdentifiers) > 0 {
+			logger.Infof("%d quarantined test(s) found", len(testIdentifiers))
+		}
+
+		if len(userInitScripts) > 0 {
+			logger.Printf("Applying the test filter init script after the init script(s) from the arguments: %s", strings.Join(userInitScripts, ", "))
+		}
+
+		logger.Printf("Writing Gradle init script for filtering tests...")
+
+		initScriptPth, err = gradleconfig.WriteTestFilterInitScript(testFilters, testIdentifiers)
+		if err != nil {
+			return fmt.Errorf("Run: failed to write test filter init script: %s", err)
+		}
+
+		args = append(args, "--init-script", initScriptPth)
+
+		defer func() {
+			logger.Println()
+			logger.Printf("Removing test filter init script: %s", initScriptPth)
+			if err := os.RemoveAll(filepath.Dir(initScriptPth)); err != nil {
+				logger.Warnf("Run: failed to remove test filter init script (%s): %s", initScriptPth, err)
 			}
+		}()
+	}
+
+	if config.RetryPluginMaxRetries > 0 {
+		logger.Println()
+		logger.Infof("Test retry plugin:")
+		logger.Printf("Writing Gradle init script for applying the test-retry plugin...")
+
+		retryPluginInitScriptPth, err := gradleconfig.WriteTestRetryPluginInitScript(gradleconfig.TestRetryPluginConfig{
+			Version:                config.RetryPluginVersion,
+			Repository:             config.RetryPluginRepository,
+			MaxRetries:             config.RetryPluginMaxRetries,
+			MaxFailures:            config.RetryPluginMaxFailures,
+			FailOnPassedAfterRetry: config.RetryPluginFailOnPassedAfterRetry,
+		})
+		if err != nil {
+			return fmt.Errorf("Run: failed to write test-retry plugin init script: %s", err)
 		}
 
+		retryPluginArgs := []string{"--init-script", retryPluginInitScriptPth}
+		args = append(args, retryPluginArgs...)
+		baseArgs = append(baseArgs, retryPluginArgs...)
+
+		defer func() {
+			if err := os.RemoveAll(filepath.Dir(retryPluginInitScriptPth)); err != nil {
+				logger.Warnf("Run: failed to remove test-retry plugin init script (%s): %s", retryPluginInitScriptPth, err)
+			}
+		}()
+	}
+
+	var shardingArgs []string
+	if config.ShardCount > 1 {
 		logger.Println()
-		logger.Infof("%d quarantined test(s) found", len(testIdentifiers))
-		logger.Printf("Writing Gradle init script for excluding quarantined tests...")
+		logger.Infof("Test sharding:")
 
-		initScriptPth, err = gradleconfig.WriteSkipTestingInitScript(testIdentifiers)
+		// Every module is searched for test classes, so that the shards do not depend on the module selection of the worker.
+		var moduleDirs []string
+		for _, module := range moduleNames {
+			moduleDirs = append(moduleDirs, moduleProjectDir(graph, config.ProjectLocation, module))
+		}
+
+		shards, err := planShards(moduleDirs, config.ShardTimingsDir, config.ShardCount, logger)
 		if err != nil {
-			return fmt.Errorf("Run: failed to write quarantine init script: %s", err)
+			return fmt.Errorf("Run: failed to plan test shards: %s", err)
 		}
 
-		args = append(args, "--init-script", initScriptPth)
+		for _, shard := range shards {
+			line := fmt.Sprintf("shard %d: %d test class(es), estimated weight: %.2f", shard.Index, len(shard.Classes), shard.Duration)
+			if shard.Index == config.ShardIndex {
+				logger.Donef("✓ %s", line)
+			} else {
+				logger.Printf("- %s", line)
+			}
+		}
+
+		logger.Printf("Writing Gradle init script for running shard %d/%d...", config.ShardIndex, config.ShardCount)
+
+		shardingInitScriptPth, err := gradleconfig.WriteShardingInitScript(config.ShardIndex, config.ShardCount, sharding.Assignments(shards))
+		if err != nil {
+			return fmt.Errorf("Run: failed to write sharding init script: %s", err)
+		}
+
+		shardingArgs = []string{"--init-script", shardingInitScriptPth}
+		args = append(args, shardingArgs...)
 
 		defer func() {
 			logger.Println()
-			logger.Printf("Removing test quarantine init script: %s", initScriptPth)
-			if err := os.RemoveAll(initScriptPth); err != nil {
-				logger.Warnf("Run: failed to remove skip testing init script (%s): %s", initScriptPth, err)
+			logger.Printf("Removing test sharding init script: %s", shardingInitScriptPth)
+			if err := os.RemoveAll(filepath.Dir(shardingInitScriptPth)); err != nil {
+				logger.Warnf("Run: failed to remove test sharding init script (%s): %s", shardingInitScriptPth, err)
 			}
 		}()
 	}
 
+	// The JaCoCo agent is only applied to the first test run, the retried and quarantined tests do not contribute to the coverage.
+	// Kover instruments every run of the test tasks from the build scripts, so the coverage reports are generated
+	// right after the first test run, before a retry or the quarantined test run could overwrite its coverage data.
+	var coverageArgs []string
+	var coverageVariants coverageToolVariants
+	if config.Coverage {
+		logger.Println()
+		logger.Infof("Coverage:")
+
+		// Modules with the Kover plugin have a koverXmlReport<Variant> task for each of their build variants,
+		// these are listed the same way as the unit test tasks.
+		koverVariants, err := gradleProject.GetTask(gradleconfig.KoverXMLReportTaskName).GetVariants(baseArgs...)
+		if err != nil {
+			logger.Warnf("Failed to list the Kover report tasks, collecting coverage of every module with JaCoCo: %s", err)
+		}
+		coverageVariants = splitCoverageVariants(filteredVariants, koverVariants)
+
+		for _, module := range moduleNames {
+			if len(coverageVariants.Kover[module]) > 0 {
+				logger.Printf("%s: Kover", module)
+			} else if len(coverageVariants.Jacoco[module]) > 0 {
+				logger.Printf("%s: JaCoCo", module)
+			}
+		}
+
+		if len(coverageVariants.Jacoco) > 0 {
+			logger.Printf("Writing Gradle init script for collecting JaCoCo coverage...")
+
+			coverageInitScriptPth, err := gradleconfig.WriteJacocoInitScript(taskPaths("test", "UnitTest", coverageVariants.Kover))
+			if err != nil {
+				return fmt.Errorf("Run: failed to write coverage init script: %s", err)
+			}
+
+			coverageArgs = []string{"--init-script", coverageInitScriptPth}
+			args = append(args, coverageArgs...)
+
+			defer func() {
+				if err := os.RemoveAll(filepath.Dir(coverageInitScriptPth)); err != nil {
+					logger.Warnf("Run: failed to remove coverage init script (%s): %s", coverageInitScriptPth, err)
+				}
+			}()
+		}
+	}
+
+	xmlResultFilePattern := config.XMLResultDirPattern
+	if !strings.HasSuffix(xmlResultFilePattern, "*.xml") {
+		xmlResultFilePattern += "*.xml"
+	}
+
 	started := time.Now()
 
-	var testErr error
+	var coverageReports []coverage.Report
+	var coverageReportsTime time.Duration
+
+	testErr := runTestAttempts(func() error {
+		logger.Println()
+		logger.Infof("Run test:")
+		testCommand := testTask.GetCommand(filteredVariants, args...)
+		logger.Donef("$ " + testCommand.PrintableCommandArgs())
+
+		err := testCommand.Run()
+		if err != nil {
+			logger.Errorf("Run: test task failed: %v", err)
+		} else {
+			logger.Donef("Successful test run")
+		}
+		return err
+	}, func() {
+		if !config.Coverage {
+			return
+		}
+
+		coverageStarted := time.Now()
+		reportArgs := append(slices.Clone(baseArgs), coverageArgs...)
+		coverageReports = runCoverageReports(gradleProject, graph, config.ProjectLocation, coverageVariants, reportArgs, config.DeployDir, exporter, logger)
+		coverageReportsTime = time.Since(coverageStarted)
+	}, func(testErr error) error {
+		if config.MaxRetries == 0 {
+			return testErr
+		}
+
+		retryArgs := append(slices.Clone(baseArgs), shardingArgs...)
+		return retryFailedTests(testTask, gradleProject, filteredVariants, retryArgs, testIdentifiers, xmlResultFilePattern, config.MaxRetries, started, testErr, logger)
+	})
+	// The wall time of the test runs, without generating the coverage reports.
+	wallTime := time.Since(started) - coverageReportsTime
+
+	// - <project_dir>/app/build/test-results/testDebugUnitTest/TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml
+	// - <project_dir>/app/build/test-results/testReleaseUnitTest/TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml
+	resultXMLs, resultXMLsErr := getArtifacts(gradleProject, started, xmlResultFilePattern, false, false, logger)
+	if resultXMLsErr != nil {
+		logger.Warnf("Failed to find test XML test results: %s", resultXMLsErr)
+	}
+
+	if testErr != nil && config.FailureReportMaxLines > 0 && resultXMLsErr == nil {
+		logger.Println()
+		logger.Infof("Failed tests:")
 
+		if err := exporter.ReportFailedTests(resultXMLs, config.FailureReportMaxLines); err != nil {
+			logger.Warnf("Failed to report failed tests: %s", err)
+		}
+	}
+
+	// The counts are exported even if the test task failed or no test result was found.
 	logger.Println()
-	logger.Infof("Run test:")
-	testCommand := testTask.GetCommand(filteredVariants, args...)
-	logger.Donef("$ " + testCommand.PrintableCommandArgs())
+	logger.Infof("Export test counts:")
 
-	testErr = testCommand.Run()
-	if testErr != nil {
-		logger.Errorf("Run: test task failed: %v", testErr)
-	} else {
-		logger.Donef("Successful test run")
+	if err := exporter.ExportTestCounts(resultXMLs, testIdentifiers, testSuiteNames(graph, config.ProjectLocation, filteredVariants), wallTime); err != nil {
+		logger.Warnf("Failed to export test counts: %s", err)
 	}
 
 	logger.Println()
@@ -174,40 +481,311 @@ func runStep(logger log.Logger) error {
 		return fmt.Errorf("Export outputs: failed to export results: %v", err)
 	}
 
-	if config.TestResultDir != "" {
+	if len(testFilters) > 0 && resultXMLsErr == nil {
+		logger.Println()
+		logger.Infof("Check test filter patterns:")
+
+		if err := exporter.ReportUnmatchedTestFilters(testFilters, resultXMLs); err != nil {
+			logger.Warnf("Failed to check test filter patterns: %s", err)
+		}
+	}
+
+	if len(testIdentifiers) > 0 && resultXMLsErr == nil {
+		logger.Println()
+		logger.Infof("Check quarantined tests:")
+
+		if testClasses, err := compiledTestClasses(graph, config.ProjectLocation, filteredVariants); err != nil {
+			logger.Warnf("Failed to list compiled test classes: %s", err)
+		} else if err := exporter.ReportStaleQuarantinedTests(testIdentifiers, testClasses, resultXMLs); err != nil {
+			logger.Warnf("Failed to check quarantined tests: %s", err)
+		}
+	}
+
+	if config.TestResultDir != "" && resultXMLsErr == nil {
 		// Test Addon is turned on
 		logger.Println()
 		logger.Infof("Export XML results for test addon:")
 
-		xmlResultFilePattern := config.XMLResultDirPattern
-		if !strings.HasSuffix(xmlResultFilePattern, "*.xml") {
-			xmlResultFilePattern += "*.xml"
+		exportedResultXMLs, err := exporter.ExportTestAddonArtifacts(config.TestResultDir, resultXMLs)
+		if err != nil {
+			logger.Warnf("Failed to export test XML test results: %s", err)
 		}
 
-		// - <project_dir>/app/build/test-results/testDebugUnitTest/TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml
-		// - <project_dir>/app/build/test-results/testReleaseUnitTest/TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml
-		resultXMLs, err := getArtifacts(gradleProject, started, xmlResultFilePattern, false, false, logger)
-		if err != nil {
-			logger.Warnf("Failed to find test XML test results: %s", err)
-		} else {
-			exportedResultXMLs, err := exporter.ExportTestAddonArtifacts(config.TestResultDir, resultXMLs)
-			if err != nil {
-				logger.Warnf("Failed to export test XML test results: %s", err)
-			}
+		if err := exporter.ExportFlakyTestsEnvVar(exportedResultXMLs); err != nil {
+			logger.Warnf("Failed to export flaky tests env var: %s", err)
+		}
+	}
+
+	if resultXMLsErr == nil {
+		logger.Println()
+		logger.Infof("Export flaky tests report:")
 
-			if err := exporter.ExportFlakyTestsEnvVar(exportedResultXMLs); err != nil {
-				logger.Warnf("Failed to export flaky tests env var: %s", err)
+		if err := exporter.ExportFlakyTestsReport(config.DeployDir, resultXMLs); err != nil {
+			logger.Warnf("Failed to export flaky tests report: %s", err)
+		}
+
+		logger.Println()
+		logger.Infof("Export failed test cases:")
+
+		if err := exporter.ExportFailedTestCases(config.DeployDir, resultXMLs); err != nil {
+			logger.Warnf("Failed to export failed test cases: %s", err)
+		}
+
+		if config.MergeTestResults {
+			logger.Println()
+			logger.Infof("Export merged XML results:")
+
+			if err := exporter.ExportMergedTestResults(config.DeployDir, resultXMLs); err != nil {
+				logger.Warnf("Failed to export merged test results: %s", err)
 			}
 		}
+
+		logger.Println()
+		logger.Infof("Export CTRF report:")
+
+		if err := exporter.ExportCTRFReport(config.DeployDir, resultXMLs, started, started.Add(wallTime)); err != nil {
+			logger.Warnf("Failed to export CTRF report: %s", err)
+		}
+
+		logger.Println()
+		logger.Infof("Export test summary:")
+
+		if err := exporter.ExportTestSummary(config.DeployDir, resultXMLs); err != nil {
+			logger.Warnf("Failed to export test summary: %s", err)
+		}
+	}
+
+	var quarantinedResultXMLs []gradle.Artifact
+	if config.RunQuarantinedTests && len(testIdentifiers) > 0 {
+		// The quarantined test run never fails the step, its results are only reported.
+		quarantinedArgs := append(slices.Clone(baseArgs), shardingArgs...)
+		quarantinedResultXMLs = runQuarantinedTests(testTask, gradleProject, filteredVariants, testIdentifiers, testFilters, quarantinedArgs, config.TestResultDir, exporter, logger)
+	}
+
+	// The history is updated after the quarantined test run, so that it tracks the quarantined tests as well.
+	if config.FlakinessHistoryDir != "" && resultXMLsErr == nil {
+		logger.Println()
+		logger.Infof("Update flakiness history:")
+
+		if err := exporter.UpdateFlakinessHistory(config.FlakinessHistoryDir, config.FlakinessThreshold/100, resultXMLs, quarantinedResultXMLs); err != nil {
+			logger.Warnf("Failed to update flakiness history: %s", err)
+		}
+	}
+
+	if len(quarantinedResultXMLs) > 0 {
+		logger.Println()
+		logger.Infof("Quarantined test results:")
+
+		if err := exporter.ReportQuarantinedTestResults(testIdentifiers, quarantinedResultXMLs, config.FlakinessHistoryDir); err != nil {
+			logger.Warnf("Failed to check quarantined test results: %s", err)
+		}
+	}
+
+	// The thresholds are checked once every report is exported, so that a failing gate does not lose any of them.
+	var coverageErr error
+	if len(coverageRules) > 0 {
+		coverageErr = checkCoverageThresholds(coverageReports, coverageRules, config.CoverageThresholdAction == "fail", logger)
 	}
 
 	if testErr != nil {
 		return fmt.Errorf("Running tests failed: %w", testErr)
 	}
 
+	if coverageErr != nil && config.CoverageThresholdAction == "fail" {
+		return fmt.Errorf("Coverage check failed: %w", coverageErr)
+	}
+
 	return nil
 }
 
+// runTestAttempts runs the tests, generates the coverage reports of this first run and only then retries the failed tests,
+// so that the coverage reports cover the full test run, not only the retried tests. The returned error is the result of the last attempt.
+func runTestAttempts(runTests func() error, generateCoverageReports func(), retryFailedTests func(testErr error) error) error {
+	testErr := runTests()
+	generateCoverageReports()
+	if testErr != nil {
+		testErr = retryFailedTests(testErr)
+	}
+	return testErr
+}
+
+// retryFailedTests reruns the failed test cases of the previous attempt, until they pass or the retries run out.
+// The results of every attempt are kept, the returned error is the result of the last attempt.
+func retryFailedTests(testTask *gradle.Task, gradleProject gradle.Project, variants gradle.Variants, args []string, quarantinedTests []gradleconfig.TestPattern, resultPattern string, maxRetries int, started time.Time, testErr error, logger log.Logger) error {
+	stashDir, err := pathutil.NewPathProvider().CreateTempDir("test-attempts")
+	if err != nil {
+		logger.Warnf("Failed to create temp dir for the test results of the attempts: %s", err)
+		return testErr
+	}
+	defer func() {
+		if err := os.RemoveAll(stashDir); err != nil {
+			logger.Warnf("Failed to remove the test results of the attempts (%s): %s", stashDir, err)
+		}
+	}()
+
+	attempts := retry.NewAttempts(stashDir)
+	attemptStarted := started
+
+	for attempt := 1; attempt <= maxRetries && testErr != nil; attempt++ {
+		logger.Println()
+		logger.Infof("Retry failed tests (attempt %d/%d):", attempt+1, maxRetries+1)
+
+		resultXMLs, err := getArtifacts(gradleProject, attemptStarted, resultPattern, false, false, logger)
+		if err != nil {
+			logger.Warnf("Failed to find test XML results: %s", err)
+			break
+		}
+
+		failedTests, err := retry.FailedTests(resultXMLs)
+		if err != nil {
+			logger.Warnf("Failed to collect the failed test cases: %s", err)
+			break
+		}
+		if len(failedTests) == 0 {
+			logger.Warnf("No failed test case found in the test results, the failure is not retried")
+			break
+		}
+
+		logger.Printf("%d failed test case(s):", len(failedTests))
+		for _, failedTest := range failedTests {
+			if len(failedTest.TestSuiteNames) > 0 {
+				logger.Printf("- %s (%s)", failedTest.Pattern, strings.Join(failedTest.TestSuiteNames, ", "))
+			} else {
+				logger.Printf("- %s", failedTest.Pattern)
+			}
+		}
+
+		if err := attempts.Stash(attempt, resultXMLs); err != nil {
+			logger.Warnf("Failed to keep the test results of attempt %d: %s", attempt, err)
+			break
+		}
+
+		initScriptPth, err := gradleconfig.WriteTestFilterInitScript(failedTests, quarantinedTests)
+		if err != nil {
+			logger.Warnf("Failed to write test retry init script: %s", err)
+			break
+		}
+
+		attemptStarted = time.Now()
+
+		testCommand := testTask.GetCommand(variants, append(slices.Clone(args), "--init-script", initScriptPth)...)
+		logger.Donef("$ " + testCommand.PrintableCommandArgs())
+
+		failedErr := testErr
+		testErr = testCommand.Run()
+		if testErr != nil {
+			logger.Errorf("Run: test task failed: %v", testErr)
+		} else {
+			logger.Donef("Successful test run")
+		}
+
+		if err := os.RemoveAll(filepath.Dir(initScriptPth)); err != nil {
+			logger.Warnf("Failed to remove test retry init script (%s): %s", initScriptPth, err)
+		}
+
+		if testErr == nil {
+			// The retry does not fail on patterns matching no test, so a successful retry is only accepted
+			// if every failed test case ran again.
+			if err := checkRetriedTests(gradleProject, attemptStarted, resultPattern, failedTests, logger); err != nil {
+				logger.Errorf("Run: %s", err)
+				testErr = failedErr
+				break
+			}
+		}
+	}
+
+	restored, err := attempts.Restore()
+	if err != nil {
+		logger.Warnf("Failed to restore the test results of the previous attempts: %s", err)
+	}
+	if len(restored) > 0 {
+		logger.Printf("Restored %d test result(s) of the previous attempts", len(restored))
+	}
+
+	return testErr
+}
+
+// checkRetriedTests checks if every failed test case ran in the retry attempt started at the given time.
+func checkRetriedTests(gradleProject gradle.Project, attemptStarted time.Time, resultPattern string, failedTests []gradleconfig.TestPattern, logger log.Logger) error {
+	// Only the results of the retry attempt are checked, the results of the previous attempt are still on disk.
+	resultXMLs, err := gradleProject.FindArtifacts(attemptStarted, resultPattern, false)
+	if err != nil {
+		return fmt.Errorf("failed to find the test XML results of the retry: %w", err)
+	}
+
+	notRun, err := retry.NotRunTests(failedTests, resultXMLs)
+	if err != nil {
+		return fmt.Errorf("failed to check the test XML results of the retry: %w", err)
+	}
+	if len(notRun) == 0 {
+		return nil
+	}
+
+	logger.Printf("%d failed test case(s) did not run in the retry:", len(notRun))
+	for _, failedTest := range notRun {
+		if len(failedTest.TestSuiteNames) > 0 {
+			logger.Printf("- %s (%s)", failedTest.Pattern, strings.Join(failedTest.TestSuiteNames, ", "))
+		} else {
+			logger.Printf("- %s", failedTest.Pattern)
+		}
+	}
+	return fmt.Errorf("%d failed test case(s) did not run in the retry, the test failure is kept", len(notRun))
+}
+
+// runQuarantinedTests runs the quarantined tests selected by the test filter with test failures ignored,
+// exports their results for the test addon and returns them.
+func runQuarantinedTests(testTask *gradle.Task, gradleProject gradle.Project, variants gradle.Variants, quarantinedTests, testFilters []gradleconfig.TestPattern, args []string, testResultDir string, exporter output.Exporter, logger log.Logger) []gradle.Artifact {
+	logger.Println()
+	logger.Infof("Run quarantined tests:")
+
+	quarantinedTests = gradleconfig.NarrowTestPatterns(quarantinedTests, testFilters)
+	if len(quarantinedTests) == 0 {
+		logger.Warnf("None of the quarantined tests is selected by the test filter")
+		return nil
+	}
+
+	initScriptPth, err := gradleconfig.WriteQuarantinedTestsInitScript(quarantinedTests)
+	if err != nil {
+		logger.Warnf("Failed to write quarantined tests init script: %s", err)
+		return nil
+	}
+	defer func() {
+		if err := os.RemoveAll(filepath.Dir(initScriptPth)); err != nil {
+			logger.Warnf("Failed to remove quarantined tests init script (%s): %s", initScriptPth, err)
+		}
+	}()
+
+	started := time.Now()
+
+	testCommand := testTask.GetCommand(variants, append(args, "--init-script", initScriptPth)...)
+	logger.Donef("$ " + testCommand.PrintableCommandArgs())
+
+	if err := testCommand.Run(); err != nil {
+		logger.Warnf("Quarantined test run failed: %v", err)
+	} else {
+		logger.Donef("Quarantined test run finished")
+	}
+
+	// - <project_dir>/app/build/quarantined-test-results/testDebugUnitTest/TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml
+	resultXMLs, err := getArtifacts(gradleProject, started, "*build/"+testaddon.QuarantinedTestResultsDirName+"/*.xml", false, false, logger)
+	if err != nil {
+		logger.Warnf("Failed to find quarantined test XML results: %s", err)
+		return nil
+	}
+
+	if testResultDir != "" {
+		// Test Addon is turned on
+		logger.Println()
+		logger.Infof("Export quarantined XML results for test addon:")
+
+		if _, err := exporter.ExportTestAddonArtifacts(testResultDir, resultXMLs); err != nil {
+			logger.Warnf("Failed to export quarantined test XML results: %s", err)
+		}
+	}
+
+	return resultXMLs
+}
+
 func getArtifacts(gradleProject gradle.Project, started time.Time, pattern string, includeModuleName bool, isDirectoryMode bool, logger log.Logger) (artifacts []gradle.Artifact, err error) {
 	for _, t := range []time.Time{started, {}} {
 		if isDirectoryMode {
@@ -232,15 +810,52 @@ func getArtifacts(gradleProject gradle.Project, started time.Time, pattern strin
 	return
 }
 
-func filterVariants(module, variant string, variantsMap gradle.Variants) (gradle.Variants, error) {
-	// if module set: drop all the other modules
-	if module != "" {
-		v, ok := variantsMap[module]
-		if !ok {
-			return nil, fmt.Errorf("module not found: %s", module)
+// listVariantsWithGraph lists the unit test variants and writes the project graph in the same Gradle invocation.
+// The variants are nil if the listing failed, the graph is empty if it could not be read.
+func listVariantsWithGraph(testTask *gradle.Task, args []string, logger log.Logger) (gradle.Variants, affected.Graph, error) {
+	graphInitScriptPth, err := gradleconfig.WriteProjectGraphInitScript()
+	if err != nil {
+		return nil, affected.Graph{}, fmt.Errorf("failed to write project graph init script: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(filepath.Dir(graphInitScriptPth)); err != nil {
+			logger.Warnf("Failed to remove project graph init script (%s): %s", graphInitScriptPth, err)
+		}
+	}()
+
+	variants, err := testTask.GetVariants(append(slices.Clone(args), gradleconfig.InitScriptArgs([]string{graphInitScriptPth})...)...)
+	if err != nil {
+		return nil, affected.Graph{}, fmt.Errorf("failed to fetch variants with the project graph init script: %w", err)
+	}
+
+	graph, err := affected.LoadGraph(filepath.Join(filepath.Dir(graphInitScriptPth), gradleconfig.ProjectGraphFileName))
+	if err != nil {
+		return variants, affected.Graph{}, fmt.Errorf("failed to read project graph: %w", err)
+	}
+
+	return variants, graph, nil
+}
+
+// hasScopedTestPatterns checks if any of the patterns is scoped to test suites.
+func hasScopedTestPatterns(patterns []gradleconfig.TestPattern) bool {
+	return slices.ContainsFunc(patterns, func(pattern gradleconfig.TestPattern) bool {
+		return len(pattern.TestSuiteNames) > 0
+	})
+}
+
+func filterVariants(modules map[string]moduleSelection, variant string, variantsMap gradle.Variants) (gradle.Variants, error) {
+	// drop the modules which are not selected
+	selectedVariants := gradle.Variants{}
+	for m, variants := range variantsMap {
+		if modules[m].Included {
+			selectedVariants[m] = variants
 		}
-		variantsMap = gradle.Variants{module: v}
 	}
+	if len(selectedVariants) == 0 {
+		return nil, fmt.Errorf("every module is excluded")
+	}
+	variantsMap = selectedVariants
+
 	// if variant not set: use all variants
 	if variant == "" {
 		return variantsMap, nil
@@ -259,7 +874,85 @@ func filterVariants(module, variant string, variantsMap gradle.Variants) (gradle
 	return filteredVariants, nil
 }
 
-func parseQuarantinedTests(input string) ([]string, error) {
+func planShards(moduleDirs []string, timingsDir string, shardCount int, logger log.Logger) ([]sharding.Shard, error) {
+	classes, err := sharding.DiscoverTestClasses(moduleDirs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover test classes: %w", err)
+	}
+	logger.Printf("%d test class(es) found in the unit test source sets", len(classes))
+
+	var timings map[string]float64
+	if timingsDir != "" {
+		timings, err = sharding.LoadTimings(timingsDir)
+		if err != nil {
+			logger.Warnf("Failed to load test timings, balancing shards by test class count: %s", err)
+			timings = nil
+		} else {
+			logger.Printf("Timing data found for %d test class(es) in %s", len(timings), timingsDir)
+		}
+	}
+
+	if len(timings) == 0 {
+		logger.Printf("No timing data available, balancing shards by test class count")
+	}
+
+	return sharding.Plan(classes, timings, shardCount), nil
+}
+
+func filterAffectedVariants(projectLocation, ref string, graph affected.Graph, variantsMap gradle.Variants, cmdFactory command.Factory, logger log.Logger) (gradle.Variants, error) {
+	rootDir, err := filepath.Abs(projectLocation)
+	if err != nil {
+		return nil, err
+	}
+	if rootDir, err = filepath.EvalSymlinks(rootDir); err != nil {
+		return nil, err
+	}
+
+	changedFiles, err := affected.ChangedFiles(cmdFactory, rootDir, ref, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("%d file(s) changed since %s", len(changedFiles), ref)
+
+	selection := affected.Select(graph, rootDir, changedFiles)
+	if selection.FullRun {
+		logger.Warnf("Testing every selected module, %s", selection.FullRunReason)
+		return variantsMap, nil
+	}
+
+	var modules []string
+	for module := range variantsMap {
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+
+	affectedVariants := gradle.Variants{}
+	for _, module := range modules {
+		if reason, ok := selection.Modules[module]; ok {
+			logger.Donef("✓ %s (%s)", module, reason)
+			affectedVariants[module] = variantsMap[module]
+		} else {
+			logger.Printf("- %s (not affected)", module)
+		}
+	}
+
+	return affectedVariants, nil
+}
+
+// moduleBuildTypes maps the module names (as used in the variants map) to the Android build types of the modules.
+func moduleBuildTypes(graph affected.Graph) map[string][]string {
+	buildTypes := map[string][]string{}
+	for projectPath, projectBuildTypes := range graph.BuildTypes {
+		buildTypes[affected.ModuleName(projectPath)] = projectBuildTypes
+	}
+	return buildTypes
+}
+
+// parseQuarantinedTests converts the quarantined tests into Gradle test filter exclude patterns.
+// An entry without a test case name excludes the whole class, '*' wildcards in the test case name
+// (for example shouldParse*) exclude every matching test method. Entries which don't result in a valid
+// Gradle test filter pattern are dropped with a warning.
+func parseQuarantinedTests(input string, logger log.Logger) ([]gradleconfig.TestPattern, error) {
 	if input == "" {
 		return nil, nil
 	}
@@ -269,16 +962,44 @@ func parseQuarantinedTests(input string) ([]string, error) {
 		return nil, fmt.Errorf("failed to parse quarantined tests input: %w", err)
 	}
 
-	var skippedTests []string
-	for _, qt := range quarantinedTests {
-		if qt.ClassName == "" || qt.TestCaseName == "" {
+	var skippedTests []gradleconfig.TestPattern
+	for i, qt := range quarantinedTests {
+		packageAndClassName := strings.TrimSpace(qt.ClassName)
+		testMethodName := strings.TrimSpace(qt.TestCaseName)
+
+		if reason := invalidQuarantinedTestReason(packageAndClassName, testMethodName); reason != "" {
+			logger.Warnf("Quarantined test #%d (class: %q, test case: %q) is ignored: %s", i+1, qt.ClassName, qt.TestCaseName, reason)
 			continue
 		}
 
-		packageAndClassName := qt.ClassName
-		testMethodName := qt.TestCaseName
+		pattern := gradleconfig.TestFilterPattern(packageAndClassName, testMethodName)
+		if err := gradleconfig.ValidateTestPattern(pattern); err != nil {
+			logger.Warnf("Quarantined test #%d (class: %q, test case: %q) is ignored: %s", i+1, qt.ClassName, qt.TestCaseName, err)
+			continue
+		}
 
-		skippedTests = append(skippedTests, fmt.Sprintf("%s.%s", packageAndClassName, testMethodName))
+		// Entries without a test suite name are excluded from every test suite.
+		var testSuiteNames []string
+		for _, testSuiteName := range qt.TestSuiteName {
+			if testSuiteName != "" {
+				testSuiteNames = append(testSuiteNames, testSuiteName)
+			}
+		}
+
+		skippedTests = append(skippedTests, gradleconfig.TestPattern{
+			Pattern:        pattern,
+			TestSuiteNames: testSuiteNames,
+		})
 	}
 	return skippedTests, nil
 }
+
+func invalidQuarantinedTestReason(className, testCaseName string) string {
+	switch {
+	case className == "":
+		return "missing class name"
+	case strings.Trim(className, "*.") == "" && strings.Trim(testCaseName, "*") == "":
+		return "it would exclude every test"
+	}
+	return ""
+}
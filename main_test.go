@@ -1,13 +1,19 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/bitrise-io/go-android/v2/gradle"
 	"github.com/bitrise-io/go-utils/v2/log"
 	"github.com/bitrise-io/go-utils/v2/pathutil"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/affected"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
 	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -80,3 +86,217 @@ func Test_tryExportTestAddonArtifact(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseModulePatterns(t *testing.T) {
+	require.Equal(t, []string{"app", "feature:*", "core:network", "lib"}, parseModulePatterns("app, feature:*\n:core:network\n\nlib"))
+	require.Nil(t, parseModulePatterns(""))
+}
+
+func Test_selectModules(t *testing.T) {
+	variantsMap := gradle.Variants{
+		"app":               {"DebugUnitTest"},
+		"core:network":      {"DebugUnitTest"},
+		"feature:login":     {"DebugUnitTest"},
+		"feature:legacyMap": {"DebugUnitTest"},
+	}
+
+	tests := []struct {
+		name            string
+		includePatterns []string
+		excludePatterns []string
+		want            map[string]moduleSelection
+		wantErr         string
+	}{
+		{
+			name: "Every module is selected without patterns",
+			want: map[string]moduleSelection{
+				"app":               {Included: true},
+				"core:network":      {Included: true},
+				"feature:login":     {Included: true},
+				"feature:legacyMap": {Included: true},
+			},
+		},
+		{
+			name:            "Globs and exclusions",
+			includePatterns: []string{"feature:*", "core:network"},
+			excludePatterns: []string{"feature:legacy*"},
+			want: map[string]moduleSelection{
+				"app":               {Included: false, Rule: "not selected"},
+				"core:network":      {Included: true, Rule: `included by "core:network"`},
+				"feature:login":     {Included: true, Rule: `included by "feature:*"`},
+				"feature:legacyMap": {Included: false, Rule: `excluded by "feature:legacy*"`},
+			},
+		},
+		{
+			name:            "Exclusions only",
+			excludePatterns: []string{"app"},
+			want: map[string]moduleSelection{
+				"app":               {Included: false, Rule: `excluded by "app"`},
+				"core:network":      {Included: true},
+				"feature:login":     {Included: true},
+				"feature:legacyMap": {Included: true},
+			},
+		},
+		{
+			name:            "Include pattern without matching module",
+			includePatterns: []string{"app", "feature:payments", "lib*"},
+			wantErr:         "module not found: feature:payments, lib*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectModules(tt.includePatterns, tt.excludePatterns, variantsMap)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_filterVariants(t *testing.T) {
+	variantsMap := gradle.Variants{
+		"app": {"DebugUnitTest", "ReleaseUnitTest"},
+		"lib": {"DebugUnitTest"},
+	}
+
+	got, err := filterVariants(map[string]moduleSelection{"app": {Included: true}, "lib": {Included: false}}, "debug", variantsMap)
+	require.NoError(t, err)
+	require.Equal(t, gradle.Variants{"app": {"DebugUnitTest"}}, got)
+
+	_, err = filterVariants(map[string]moduleSelection{}, "", variantsMap)
+	require.EqualError(t, err, "every module is excluded")
+
+	_, err = filterVariants(map[string]moduleSelection{"lib": {Included: true}}, "release", variantsMap)
+	require.EqualError(t, err, "variant release not found in any module")
+}
+
+func Test_parseQuarantinedTests(t *testing.T) {
+	input := `[
+  {"testCaseName": "paysWithCash", "className": "com.acme.payments.CheckoutTest", "testSuiteName": ["app-debug", "app-freeRelease"]},
+  {"testCaseName": "parses", "className": "com.acme.ParserTest", "testSuiteName": []},
+  {"testCaseName": "", "className": "com.acme.FormatterTest", "testSuiteName": ["app-debug"]},
+  {"testCaseName": "shouldParse*", "className": "com.acme.ParserTest"},
+  {"testCaseName": "paysWithCard", "className": ""},
+  {"testCaseName": "*", "className": "*"},
+  {"testCaseName": "parses", "className": "com.acme.Parser\"Test"}
+]`
+
+	logger := mocks.NewLogger(t)
+	logger.On("Warnf", "Quarantined test #%d (class: %q, test case: %q) is ignored: %s", 5, "", "paysWithCard", "missing class name").Return()
+	logger.On("Warnf", "Quarantined test #%d (class: %q, test case: %q) is ignored: %s", 6, "*", "*", "it would exclude every test").Return()
+	logger.On("Warnf", "Quarantined test #%d (class: %q, test case: %q) is ignored: %s", 7, "com.acme.Parser\"Test", "parses", mock.Anything).Return()
+
+	got, err := parseQuarantinedTests(input, logger)
+	require.NoError(t, err)
+	require.Equal(t, []gradleconfig.TestPattern{
+		{Pattern: "com.acme.payments.CheckoutTest.paysWithCash", TestSuiteNames: []string{"app-debug", "app-freeRelease"}},
+		{Pattern: "com.acme.ParserTest.parses"},
+		{Pattern: "com.acme.FormatterTest", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "com.acme.ParserTest.shouldParse*"},
+	}, got)
+
+	got, err = parseQuarantinedTests("", logger)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func Test_compiledTestClasses(t *testing.T) {
+	projectDir := t.TempDir()
+	for _, pth := range []string{
+		"app/build/intermediates/javac/debugUnitTest/compileDebugUnitTestJavaWithJavac/classes/com/acme/CheckoutTest.class",
+		"app/build/intermediates/javac/debugUnitTest/compileDebugUnitTestJavaWithJavac/classes/com/acme/package-info.class",
+		"app/build/tmp/kotlin-classes/debugUnitTest/com/acme/ParserTest.class",
+		"app/build/tmp/kotlin-classes/debugUnitTest/com/acme/ParserTest$Nested.class",
+		"app/build/tmp/kotlin-classes/debugUnitTest/META-INF/app_debugUnitTest.kotlin_module",
+		"app/build/tmp/kotlin-classes/releaseUnitTest/com/acme/ReleaseOnlyTest.class",
+		// A module with a custom project and build directory.
+		"modules/login/out/tmp/kotlin-classes/debugUnitTest/com/acme/login/LoginTest.class",
+		"feature/login/build/tmp/kotlin-classes/debugUnitTest/com/acme/login/StaleLoginTest.class",
+	} {
+		pth = filepath.Join(projectDir, pth)
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o755))
+		require.NoError(t, os.WriteFile(pth, nil, 0o644))
+	}
+
+	graph := affected.Graph{
+		ProjectDirs: map[string]string{":feature:login": filepath.Join(projectDir, "modules", "login")},
+		BuildDirs:   map[string]string{":feature:login": filepath.Join(projectDir, "modules", "login", "out")},
+	}
+	got, err := compiledTestClasses(graph, projectDir, gradle.Variants{
+		"app":           {"DebugUnitTest"},
+		"feature:login": {"DebugUnitTest"},
+		"lib":           {"DebugUnitTest"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"app-debug": {
+			"com.acme.CheckoutTest",
+			"com.acme.ParserTest",
+			"com.acme.ParserTest$Nested",
+		},
+		"login-debug": {"com.acme.login.LoginTest"},
+	}, got)
+}
+
+func Test_testSuiteNames(t *testing.T) {
+	graph := affected.Graph{
+		ProjectDirs: map[string]string{":feature:login": "/project/modules/login", ":core": "/project/core"},
+		// A build directory outside of the project directory is named after its parent directory, as in the test addon export.
+		BuildDirs: map[string]string{":feature:login": "/project/modules/login/out", ":core": "/project/build/core"},
+	}
+	got := testSuiteNames(graph, "/project", gradle.Variants{
+		"app":           {"FreeDebugUnitTest", "DebugUnitTest"},
+		"feature:login": {"DebugUnitTest"},
+		"core":          {"DebugUnitTest"},
+	})
+	require.Equal(t, []string{"app-debug", "app-freeDebug", "build-debug", "login-debug"}, got)
+}
+
+func Test_runTestAttempts(t *testing.T) {
+	testErr := errors.New("test task failed")
+
+	tests := []struct {
+		name      string
+		runErr    error
+		retryErr  error
+		wantCalls []string
+		wantErr   error
+	}{
+		{
+			name:      "Coverage reports are generated before the failed tests are retried",
+			runErr:    testErr,
+			wantCalls: []string{"run", "coverage", "retry"},
+		},
+		{
+			name:      "The result of the last attempt is returned",
+			runErr:    testErr,
+			retryErr:  testErr,
+			wantCalls: []string{"run", "coverage", "retry"},
+			wantErr:   testErr,
+		},
+		{
+			name:      "Successful test run is not retried",
+			wantCalls: []string{"run", "coverage"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			err := runTestAttempts(func() error {
+				calls = append(calls, "run")
+				return tt.runErr
+			}, func() {
+				calls = append(calls, "coverage")
+			}, func(err error) error {
+				require.Equal(t, tt.runErr, err)
+				calls = append(calls, "retry")
+				return tt.retryErr
+			})
+			require.Equal(t, tt.wantErr, err)
+			require.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
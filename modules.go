@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+)
+
+// moduleSelection describes whether a module is selected for testing and which rule decided it.
+type moduleSelection struct {
+	Included bool
+	Rule     string
+}
+
+// parseModulePatterns parses the newline or comma separated list of module names and glob patterns.
+func parseModulePatterns(input string) []string {
+	var patterns []string
+	for _, pattern := range parseList(input) {
+		if pattern = strings.TrimPrefix(pattern, ":"); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// parseList parses a newline or comma separated list input, empty items are dropped.
+func parseList(input string) []string {
+	var items []string
+	for _, line := range strings.Split(input, "\n") {
+		for _, item := range strings.Split(line, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// selectModules decides for every module whether it is tested, based on the include and exclude patterns.
+// A module is selected if it matches any of the include patterns (or no include pattern is set)
+// and none of the exclude patterns. Every include pattern needs to match at least one module.
+func selectModules(includePatterns, excludePatterns []string, variantsMap gradle.Variants) (map[string]moduleSelection, error) {
+	modules := make([]string, 0, len(variantsMap))
+	for module := range variantsMap {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+
+	matchedIncludePatterns := map[string]bool{}
+	selections := map[string]moduleSelection{}
+
+	for _, module := range modules {
+		selection := moduleSelection{Included: len(includePatterns) == 0}
+		if !selection.Included {
+			selection.Rule = "not selected"
+		}
+
+		for _, pattern := range includePatterns {
+			if matchesModulePattern(pattern, module) {
+				matchedIncludePatterns[pattern] = true
+				if !selection.Included {
+					selection = moduleSelection{Included: true, Rule: fmt.Sprintf("included by %q", pattern)}
+				}
+			}
+		}
+
+		if selection.Included {
+			for _, pattern := range excludePatterns {
+				if matchesModulePattern(pattern, module) {
+					selection = moduleSelection{Included: false, Rule: fmt.Sprintf("excluded by %q", pattern)}
+					break
+				}
+			}
+		}
+
+		selections[module] = selection
+	}
+
+	var unmatchedPatterns []string
+	for _, pattern := range includePatterns {
+		if !matchedIncludePatterns[pattern] {
+			unmatchedPatterns = append(unmatchedPatterns, pattern)
+		}
+	}
+	if len(unmatchedPatterns) > 0 {
+		return nil, fmt.Errorf("module not found: %s", strings.Join(unmatchedPatterns, ", "))
+	}
+
+	return selections, nil
+}
+
+// matchesModulePattern matches the module name against the pattern, where '*' matches any sequence of characters.
+func matchesModulePattern(pattern, module string) bool {
+	return gradleconfig.GlobRegexp(pattern, false).MatchString(module)
+}
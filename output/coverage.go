@@ -0,0 +1,70 @@
+package output
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/coverage"
+)
+
+const (
+	coverageLinePercentEnvVarKey   = "BITRISE_COVERAGE_LINE_PERCENT"
+	coverageBranchPercentEnvVarKey = "BITRISE_COVERAGE_BRANCH_PERCENT"
+	coverageModulesEnvVarKey       = "BITRISE_COVERAGE_MODULES"
+)
+
+// ExportCoverage exports the line and branch coverage percentage of every module (with two decimals),
+// and the per module coverage as a list in the BITRISE_COVERAGE_MODULES env var.
+// A percentage is exported as an empty value if there is nothing to cover (for example a module without branches).
+func (e exporter) ExportCoverage(reports []coverage.Report) error {
+	total := coverage.Total(reports)
+
+	var modules []string
+	for _, report := range coverage.ByModule(reports) {
+		modules = append(modules, fmt.Sprintf("- %s: line %s, branch %s", report.Module, formatCoverageCounter(report.Line), formatCoverageCounter(report.Branch)))
+	}
+
+	envs := []struct {
+		key   string
+		value string
+	}{
+		{coverageLinePercentEnvVarKey, formatCoveragePercent(total.Line)},
+		{coverageBranchPercentEnvVarKey, formatCoveragePercent(total.Branch)},
+		{coverageModulesEnvVarKey, strings.Join(modules, "\n")},
+	}
+
+	var errs []error
+	for _, env := range envs {
+		e.logger.Printf("%s: %s", env.key, env.value)
+		if err := e.envRepository.Set(env.key, env.value); err != nil {
+			errs = append(errs, fmt.Errorf("failed to export %s: %w", env.key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to export coverage:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+func formatCoveragePercent(counter coverage.Counter) string {
+	percent, ok := counter.Percent()
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(percent, 'f', 2, 64)
+}
+
+func formatCoverageCounter(counter coverage.Counter) string {
+	percent := formatCoveragePercent(counter)
+	if percent == "" {
+		return "n/a"
+	}
+	return fmt.Sprintf("%s%% (%d/%d)", percent, counter.Covered, counter.Total())
+}
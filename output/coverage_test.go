@@ -0,0 +1,32 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/coverage"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportCoverage(t *testing.T) {
+	reports := []coverage.Report{
+		{Module: "feature:login", Variant: "debug", Line: coverage.Counter{Covered: 20, Missed: 20}},
+		{Module: "app", Variant: "debug", Line: coverage.Counter{Covered: 70, Missed: 10}, Branch: coverage.Counter{Covered: 6, Missed: 4}},
+		{Module: "app", Variant: "release", Line: coverage.Counter{Covered: 60, Missed: 20}, Branch: coverage.Counter{Covered: 6, Missed: 4}},
+	}
+
+	logger := mocks.NewLogger(t)
+	logger.On("Printf", mock.Anything, mock.Anything, mock.Anything).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", coverageLinePercentEnvVarKey, "75.00").Return(nil)
+	envRepository.On("Set", coverageBranchPercentEnvVarKey, "60.00").Return(nil)
+	envRepository.On("Set", coverageModulesEnvVarKey, `- app: line 81.25% (130/160), branch 60.00% (12/20)
+- feature:login: line 50.00% (20/40), branch n/a`).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+	}
+	require.NoError(t, e.ExportCoverage(reports))
+}
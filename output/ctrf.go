@@ -0,0 +1,201 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+)
+
+const (
+	ctrfReportFileName      = "ctrf-report.json"
+	ctrfReportPathEnvVarKey = "BITRISE_CTRF_REPORT_PATH"
+
+	ctrfStatusPassed  = "passed"
+	ctrfStatusFailed  = "failed"
+	ctrfStatusSkipped = "skipped"
+)
+
+// CTRFReport is a test results document in the Common Test Report Format (https://ctrf.io).
+type CTRFReport struct {
+	ReportFormat string      `json:"reportFormat"`
+	SpecVersion  string      `json:"specVersion"`
+	Results      CTRFResults `json:"results"`
+}
+
+// CTRFResults holds the tool, the summary and the test cases of a CTRF report.
+type CTRFResults struct {
+	Tool    CTRFTool    `json:"tool"`
+	Summary CTRFSummary `json:"summary"`
+	Tests   []CTRFTest  `json:"tests"`
+}
+
+// CTRFTool is the tool which produced the test results.
+type CTRFTool struct {
+	Name string `json:"name"`
+}
+
+// CTRFSummary counts the test cases by status, start and stop are Unix timestamps in milliseconds.
+type CTRFSummary struct {
+	Tests   int   `json:"tests"`
+	Passed  int   `json:"passed"`
+	Failed  int   `json:"failed"`
+	Pending int   `json:"pending"`
+	Skipped int   `json:"skipped"`
+	Other   int   `json:"other"`
+	Start   int64 `json:"start"`
+	Stop    int64 `json:"stop"`
+}
+
+// CTRFTest is a test case of a module and variant. Its duration is the one of its last execution,
+// the previous executions (for example the failed attempts of a retried test case) are listed as retry attempts.
+type CTRFTest struct {
+	Name          string             `json:"name"`
+	Status        string             `json:"status"`
+	Duration      int64              `json:"duration"`
+	Suite         string             `json:"suite,omitempty"`
+	Message       string             `json:"message,omitempty"`
+	Trace         string             `json:"trace,omitempty"`
+	Retries       int                `json:"retries"`
+	Flaky         bool               `json:"flaky"`
+	RetryAttempts []CTRFRetryAttempt `json:"retryAttempts,omitempty"`
+	Extra         CTRFTestExtra      `json:"extra"`
+}
+
+// CTRFRetryAttempt is a previous execution of a test case.
+type CTRFRetryAttempt struct {
+	Attempt  int    `json:"attempt"`
+	Status   string `json:"status"`
+	Duration int64  `json:"duration"`
+	Message  string `json:"message,omitempty"`
+	Trace    string `json:"trace,omitempty"`
+}
+
+// CTRFTestExtra holds the Gradle specific context of a test case.
+type CTRFTestExtra struct {
+	Module    string `json:"module"`
+	Variant   string `json:"variant"`
+	ClassName string `json:"className"`
+	Method    string `json:"method"`
+}
+
+// ExportCTRFReport writes the test results as a CTRF JSON document into the deploy dir,
+// and exports its path in the BITRISE_CTRF_REPORT_PATH env var.
+func (e exporter) ExportCTRFReport(deployDir string, artifacts []gradle.Artifact, start, stop time.Time) error {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	report := CTRFReport{
+		ReportFormat: "CTRF",
+		SpecVersion:  "0.0.0",
+		Results: CTRFResults{
+			Tool: CTRFTool{Name: "gradle"},
+			Summary: CTRFSummary{
+				Start: start.UnixMilli(),
+				Stop:  stop.UnixMilli(),
+			},
+			Tests: []CTRFTest{},
+		},
+	}
+
+	for _, key := range keys {
+		test := ctrfTest(key, results[key])
+
+		report.Results.Summary.Tests++
+		switch test.Status {
+		case ctrfStatusPassed:
+			report.Results.Summary.Passed++
+		case ctrfStatusFailed:
+			report.Results.Summary.Failed++
+		case ctrfStatusSkipped:
+			report.Results.Summary.Skipped++
+		}
+
+		report.Results.Tests = append(report.Results.Tests, test)
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal CTRF report: %w", err)
+	}
+
+	reportPth := filepath.Join(deployDir, ctrfReportFileName)
+	if err := os.WriteFile(reportPth, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write CTRF report (%s): %w", reportPth, err)
+	}
+
+	e.logger.Donef("%d test case(s) written to %s, exporting %s env var", len(report.Results.Tests), reportPth, ctrfReportPathEnvVarKey)
+
+	if err := e.envRepository.Set(ctrfReportPathEnvVarKey, reportPth); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", ctrfReportPathEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to export CTRF report:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+func ctrfTest(key testCaseKey, result *testCaseResults) CTRFTest {
+	test := CTRFTest{
+		Name:  testCaseName(key),
+		Suite: result.SuiteName,
+		Flaky: result.isFlaky(),
+		Extra: CTRFTestExtra{
+			Module:    key.Module,
+			Variant:   key.Variant,
+			ClassName: key.ClassName,
+			Method:    key.Name,
+		},
+	}
+
+	if len(result.Executions) == 0 {
+		return test
+	}
+
+	// The test case passed if any of its executions passed, in that case it is flaky if another execution failed.
+	last := result.Executions[len(result.Executions)-1]
+	switch {
+	case result.isSkipped():
+		test.Status = ctrfStatusSkipped
+	case result.isFailed():
+		test.Status, test.Trace = ctrfStatusFailed, result.StackTrace
+		if len(result.FailureMessages) > 0 {
+			test.Message = result.FailureMessages[0]
+		}
+	default:
+		test.Status = ctrfStatusPassed
+	}
+	test.Duration = ctrfDuration(last.Time)
+	test.Retries = len(result.Executions) - 1
+
+	for i, execution := range result.Executions[:len(result.Executions)-1] {
+		attempt := CTRFRetryAttempt{Attempt: i + 1, Duration: ctrfDuration(execution.Time)}
+		attempt.Status, attempt.Message, attempt.Trace = ctrfStatus(execution)
+		test.RetryAttempts = append(test.RetryAttempts, attempt)
+	}
+
+	return test
+}
+
+func ctrfStatus(testCase testreport.TestCase) (string, string, string) {
+	if testCase.Skipped != nil {
+		return ctrfStatusSkipped, "", ""
+	}
+	if message, failed := failureMessage(testCase); failed {
+		return ctrfStatusFailed, message, stackTrace(testCase)
+	}
+	return ctrfStatusPassed, "", ""
+}
+
+func ctrfDuration(seconds float64) int64 {
+	return time.Duration(seconds * float64(time.Second)).Milliseconds()
+}
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportCTRFReport(t *testing.T) {
+	artifacts := testResultArtifacts("ctrf", "app/build/test-results/testFreeDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml")
+	deployDir := t.TempDir()
+	reportPth := filepath.Join(deployDir, ctrfReportFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Donef", mock.Anything, 4, reportPth, ctrfReportPathEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", ctrfReportPathEnvVarKey, reportPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	start := time.UnixMilli(1700000000000)
+	err := e.ExportCTRFReport(deployDir, artifacts, start, start.Add(75*time.Second))
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(reportPth)
+	require.NoError(t, err)
+	want, err := os.ReadFile(filepath.Join("testdata", "ctrf-report.json"))
+	require.NoError(t, err)
+	require.JSONEq(t, string(want), string(content))
+}
+
+func Test_exporter_ExportCTRFReport_attempts(t *testing.T) {
+	artifacts := testResultArtifacts("attempts",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest-attempt2.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest-attempt1.xml",
+	)
+	deployDir := t.TempDir()
+	reportPth := filepath.Join(deployDir, ctrfReportFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Donef", mock.Anything, 3, reportPth, ctrfReportPathEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", ctrfReportPathEnvVarKey, reportPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	start := time.UnixMilli(1700000000000)
+	err := e.ExportCTRFReport(deployDir, artifacts, start, start.Add(time.Second))
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(reportPth)
+	require.NoError(t, err)
+	var report CTRFReport
+	require.NoError(t, json.Unmarshal(content, &report))
+
+	var parsesDecimal CTRFTest
+	for _, test := range report.Results.Tests {
+		if test.Extra.Method == "parsesDecimal" {
+			parsesDecimal = test
+		}
+	}
+	require.Equal(t, ctrfStatusPassed, parsesDecimal.Status)
+	require.True(t, parsesDecimal.Flaky)
+	require.Equal(t, 2, parsesDecimal.Retries)
+	require.Len(t, parsesDecimal.RetryAttempts, 2)
+	require.Equal(t, ctrfStatusFailed, parsesDecimal.RetryAttempts[0].Status)
+	require.Equal(t, ctrfStatusFailed, parsesDecimal.RetryAttempts[1].Status)
+}
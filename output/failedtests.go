@@ -0,0 +1,58 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+)
+
+const (
+	failedTestCasesEnvVarKey              = "BITRISE_FAILED_TEST_CASES"
+	failedTestCasesEnvVarSizeLimitInBytes = 1024
+	failedTestCasesFileName               = "failed-test-cases.txt"
+	failedTestCasesPathEnvVarKey          = "BITRISE_FAILED_TEST_CASES_PATH"
+)
+
+// ExportFailedTestCases exports the test cases, which failed in every execution, in the BITRISE_FAILED_TEST_CASES env var
+// (in the format of BITRISE_FLAKY_TEST_CASES), and writes the untruncated list into the deploy dir.
+// Flaky test cases, which passed after a failure, are not considered failed.
+func (e exporter) ExportFailedTestCases(deployDir string, artifacts []gradle.Artifact) error {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	failedTestCases := testCaseNames(groupTestSuites(keys, results, testCaseResults.isFailed))
+	if len(failedTestCases) > 0 {
+		e.logger.Warnf("%d failed test case(s) detected, exporting %s env var", len(failedTestCases), failedTestCasesEnvVarKey)
+	} else {
+		e.logger.Donef("No failed test case detected")
+	}
+
+	failedTestCasesMessage := e.testCasesEnvVarValue(failedTestCasesEnvVarKey, failedTestCasesEnvVarSizeLimitInBytes, failedTestCases)
+	if err := e.envRepository.Set(failedTestCasesEnvVarKey, failedTestCasesMessage); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", failedTestCasesEnvVarKey, err))
+	}
+
+	var content strings.Builder
+	for _, testCase := range failedTestCases {
+		content.WriteString(fmt.Sprintf("- %s\n", testCase))
+	}
+
+	failedTestCasesPth := filepath.Join(deployDir, failedTestCasesFileName)
+	if err := os.WriteFile(failedTestCasesPth, []byte(content.String()), 0o644); err != nil {
+		errs = append(errs, fmt.Errorf("failed to write failed test cases (%s): %w", failedTestCasesPth, err))
+	} else if err := e.envRepository.Set(failedTestCasesPathEnvVarKey, failedTestCasesPth); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", failedTestCasesPathEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to export failed test cases:\n%s", errMsg)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportFailedTestCases(t *testing.T) {
+	// parsesDecimal passed on the retry, so it is flaky, but not failed.
+	artifacts := testResultArtifacts("failed-tests",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest-attempt1.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+	)
+
+	deployDir := t.TempDir()
+	failedTestCasesPth := filepath.Join(deployDir, failedTestCasesFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Warnf", mock.Anything, 1, failedTestCasesEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", failedTestCasesEnvVarKey, "- io.bitrise.sample.ParserTest.io.bitrise.sample.ParserTest.parsesHex\n").Return(nil)
+	envRepository.On("Set", failedTestCasesPathEnvVarKey, failedTestCasesPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportFailedTestCases(deployDir, artifacts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(failedTestCasesPth)
+	require.NoError(t, err)
+	require.Equal(t, "- io.bitrise.sample.ParserTest.io.bitrise.sample.ParserTest.parsesHex\n", string(content))
+}
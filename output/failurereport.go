@@ -0,0 +1,138 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+)
+
+// failureReportStackTraceFrames is the maximum number of stack trace frames listed per failed test case.
+const failureReportStackTraceFrames = 5
+
+// ReportFailedTests lists the failed test cases of the test results in the log, grouped by module and variant.
+// Every test case is listed with its failure message and the project frames of its stack trace.
+// The report is cut at maxLines lines.
+func (e exporter) ReportFailedTests(artifacts []gradle.Artifact, maxLines int) error {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	var failed []testCaseKey
+	for _, key := range keys {
+		if results[key].isFailed() {
+			failed = append(failed, key)
+		}
+	}
+	sort.SliceStable(failed, func(i, j int) bool {
+		return failureReportSuiteName(failed[i]) < failureReportSuiteName(failed[j])
+	})
+
+	if len(failed) == 0 {
+		e.logger.Printf("No failed test case found in the test results")
+	} else {
+		e.logger.Warnf("%d test case(s) failed:", len(failed))
+	}
+
+	lines := 0
+	suiteName := ""
+	for i, key := range failed {
+		entry := failureReportEntry(key, results[key])
+		header := failureReportSuiteName(key)
+		entryLines := 1 + len(entry)
+		if header != suiteName {
+			entryLines++
+		}
+
+		if lines+entryLines > maxLines {
+			e.logger.Warnf("Failure report limit (%d lines) reached, %d more failed test case(s) are listed in the test reports", maxLines, len(failed)-i)
+			break
+		}
+		lines += entryLines
+
+		if header != suiteName {
+			suiteName = header
+			e.logger.Printf("%s:", suiteName)
+		}
+		e.logger.Errorf("- %s", testCaseName(key))
+		for _, line := range entry {
+			e.logger.Printf("    %s", line)
+		}
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to report failed tests:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+func failureReportSuiteName(key testCaseKey) string {
+	if key.Module == "" {
+		return testaddon.OtherDirName
+	}
+	return key.Module + "-" + key.Variant
+}
+
+// failureReportEntry returns the failure message and the trimmed stack trace of a failed test case.
+// Only the frames of the test class' project (the frames sharing the first two package segments of the test class)
+// are kept, as the frames of the test frameworks rarely help to find the cause of the failure.
+func failureReportEntry(key testCaseKey, result *testCaseResults) []string {
+	if result.StackTrace == "" {
+		if len(result.FailureMessages) > 0 {
+			return firstLines(result.FailureMessages[0], summaryFailureMessageLines)
+		}
+		return nil
+	}
+
+	prefix := projectPackagePrefix(key.ClassName)
+
+	var lines []string
+	var topFrame string
+	headerLines, frames := 0, 0
+	for _, line := range strings.Split(result.StackTrace, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "at "):
+			if topFrame == "" {
+				topFrame = line
+				headerLines = len(lines)
+			}
+			if frames < failureReportStackTraceFrames && prefix != "" && strings.HasPrefix(strings.TrimPrefix(line, "at "), prefix) {
+				frames++
+				lines = append(lines, "  "+line)
+			}
+		case strings.HasPrefix(line, "Caused by:"):
+			lines = append(lines, line)
+		case topFrame == "" && line != "" && len(lines) < summaryFailureMessageLines:
+			lines = append(lines, line)
+		}
+	}
+
+	// Fall back to the top frame, if no project frame is found.
+	if frames == 0 && topFrame != "" {
+		lines = append(lines[:headerLines], append([]string{"  " + topFrame}, lines[headerLines:]...)...)
+	}
+
+	return lines
+}
+
+// projectPackagePrefix returns the first two package segments of the class name (with a trailing dot),
+// or its package, if it is shorter.
+func projectPackagePrefix(className string) string {
+	segments := strings.Split(className, ".")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	packageSegments := segments[:len(segments)-1]
+	if len(packageSegments) > 2 {
+		packageSegments = packageSegments[:2]
+	}
+	return strings.Join(packageSegments, ".") + "."
+}
@@ -0,0 +1,81 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_failureReportEntry(t *testing.T) {
+	key := testCaseKey{ClassName: "io.bitrise.sample.ParserTest", Name: "parsesDecimal"}
+
+	tests := []struct {
+		name   string
+		result testCaseResults
+		want   []string
+	}{
+		{
+			name: "Project frames",
+			result: testCaseResults{StackTrace: `java.lang.AssertionError: expected:<1.5> but was:<1.0>
+	at org.junit.Assert.fail(Assert.java:89)
+	at org.junit.Assert.assertEquals(Assert.java:120)
+	at io.bitrise.sample.Parser.parse(Parser.kt:30)
+	at io.bitrise.sample.ParserTest.parsesDecimal(ParserTest.kt:12)
+	at java.base/jdk.internal.reflect.NativeMethodAccessorImpl.invoke0(Native Method)
+	at org.junit.runners.model.FrameworkMethod$1.runReflectiveCall(FrameworkMethod.java:59)
+Caused by: java.lang.NumberFormatException: For input string: "1,5"
+	at java.base/java.lang.Double.parseDouble(Double.java:651)
+	at io.bitrise.sample.Parser.parseNumber(Parser.kt:42)
+	... 5 more`},
+			want: []string{
+				"java.lang.AssertionError: expected:<1.5> but was:<1.0>",
+				"  at io.bitrise.sample.Parser.parse(Parser.kt:30)",
+				"  at io.bitrise.sample.ParserTest.parsesDecimal(ParserTest.kt:12)",
+				`Caused by: java.lang.NumberFormatException: For input string: "1,5"`,
+				"  at io.bitrise.sample.Parser.parseNumber(Parser.kt:42)",
+			},
+		},
+		{
+			name: "Top frame without project frames",
+			result: testCaseResults{StackTrace: `java.lang.IllegalStateException: timed out
+	at org.junit.Assert.fail(Assert.java:89)
+	at org.junit.Assert.assertTrue(Assert.java:42)`},
+			want: []string{
+				"java.lang.IllegalStateException: timed out",
+				"  at org.junit.Assert.fail(Assert.java:89)",
+			},
+		},
+		{
+			name:   "Failure message without stack trace",
+			result: testCaseResults{FailureMessages: []string{"expected:<1.5> but was:<1.0>"}},
+			want:   []string{"expected:<1.5> but was:<1.0>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, failureReportEntry(key, &tt.result))
+		})
+	}
+}
+
+func Test_exporter_ReportFailedTests(t *testing.T) {
+	artifacts := testResultArtifacts("failure-report", "app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml")
+
+	logger := mocks.NewLogger(t)
+	logger.On("Warnf", mock.Anything, 2).Return()
+	logger.On("Printf", "%s:", "app-debug").Return()
+	logger.On("Errorf", "- %s", "io.bitrise.sample.ParserTest.parsesDecimal").Return()
+	logger.On("Printf", "    %s", "java.lang.AssertionError").Return()
+	logger.On("Printf", "    %s", "  at io.bitrise.sample.ParserTest.parsesDecimal(ParserTest.kt:12)").Return()
+	logger.On("Warnf", mock.Anything, 6, 1).Return()
+
+	e := exporter{
+		logger:    logger,
+		converter: junitxml.Converter{},
+	}
+	err := e.ReportFailedTests(artifacts, 6)
+	require.NoError(t, err)
+}
@@ -0,0 +1,139 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-steputils/v2/testquarantine"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/flakiness"
+)
+
+const flakyTestsQuarantineEnvVarKey = "BITRISE_FLAKY_TESTS_QUARANTINE_JSON"
+
+// UpdateFlakinessHistory appends the outcomes of the test results to the flakiness history in the given directory,
+// reports the test cases with a flakiness rate at or above the threshold (between 0 and 1) and exports them
+// in the BITRISE_FLAKY_TESTS_QUARANTINE_JSON env var, in the format of the Bitrise quarantined tests JSON.
+//
+// The outcomes of the quarantined test run are added as well, so that the history tells when a quarantined test
+// passes consistently, but the quarantined tests are not reported as flaky again.
+func (e exporter) UpdateFlakinessHistory(historyDir string, threshold float64, artifacts, quarantinedArtifacts []gradle.Artifact) error {
+	history, err := flakiness.Load(historyDir)
+	if err != nil {
+		return err
+	}
+
+	outcomes, errs := e.testOutcomes(artifacts)
+	quarantinedOutcomes, quarantinedErrs := e.testOutcomes(quarantinedArtifacts)
+	errs = append(errs, quarantinedErrs...)
+	for id, outcome := range quarantinedOutcomes {
+		outcomes[id] = outcome
+	}
+	history.Add(outcomes)
+
+	if err := history.Save(historyDir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save flakiness history: %w", err))
+	} else {
+		e.logger.Printf("Outcomes of %d test case(s) added to the flakiness history (%d test case(s) tracked)", len(outcomes), len(history.Tests))
+	}
+
+	flakyTests := slices.DeleteFunc(history.FlakyTests(threshold), func(test flakiness.FlakyTest) bool {
+		_, quarantined := quarantinedOutcomes[test.TestID]
+		return quarantined
+	})
+	if len(flakyTests) == 0 {
+		e.logger.Donef("No test case reached the %.1f%% flakiness rate", threshold*100)
+	} else {
+		e.logger.Warnf("%d test case(s) reached the %.1f%% flakiness rate, consider adding them to the quarantine:", len(flakyTests), threshold*100)
+		for _, test := range flakyTests {
+			e.logger.Printf("- %s.%s (%s): %.1f%% over %d build(s)", test.ClassName, test.Method, test.TestSuiteName, test.Rate*100, test.Builds)
+		}
+	}
+
+	content, err := json.Marshal(quarantinedTests(flakyTests))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to marshal flaky tests: %w", err))
+	} else if err := e.envRepository.Set(flakyTestsQuarantineEnvVarKey, string(content)); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", flakyTestsQuarantineEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to update flakiness history:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+// testOutcomes returns the outcome of every test case, which was not skipped, by the test case ID of the flakiness history.
+func (e exporter) testOutcomes(artifacts []gradle.Artifact) (map[flakiness.TestID]flakiness.Outcome, []error) {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	outcomes := map[flakiness.TestID]flakiness.Outcome{}
+	for _, key := range keys {
+		result := results[key]
+		if result.isSkipped() {
+			continue
+		}
+
+		switch {
+		case result.isFlaky():
+			outcomes[key.testID()] = flakiness.Mixed
+		case result.Failed > 0:
+			outcomes[key.testID()] = flakiness.Failed
+		default:
+			outcomes[key.testID()] = flakiness.Passed
+		}
+	}
+
+	return outcomes, errs
+}
+
+// testID returns the flakiness history ID of the test case, results outside of the <module>-<variant> test suites
+// have no test suite name.
+func (key testCaseKey) testID() flakiness.TestID {
+	id := flakiness.TestID{ClassName: key.ClassName, Method: key.Name}
+	if key.Module != "" {
+		id.TestSuiteName = key.Module + "-" + key.Variant
+	}
+	return id
+}
+
+// quarantinedTests converts the flaky tests to quarantined tests, merging the test suites of the same test case.
+// A test case flaky outside of the <module>-<variant> test suites is quarantined in every test suite.
+func quarantinedTests(flakyTests []flakiness.FlakyTest) []testquarantine.QuarantinedTest {
+	quarantined := []testquarantine.QuarantinedTest{}
+	indexes := map[[2]string]int{}
+	unscoped := map[int]bool{}
+
+	for _, test := range flakyTests {
+		testCase := [2]string{test.ClassName, test.Method}
+		i, ok := indexes[testCase]
+		if !ok {
+			i = len(quarantined)
+			indexes[testCase] = i
+			quarantined = append(quarantined, testquarantine.QuarantinedTest{
+				TestCaseName: test.Method,
+				ClassName:    test.ClassName,
+			})
+		}
+
+		if test.TestSuiteName == "" {
+			unscoped[i] = true
+		} else {
+			quarantined[i].TestSuiteName = append(quarantined[i].TestSuiteName, test.TestSuiteName)
+		}
+	}
+
+	for i := range quarantined {
+		if unscoped[i] {
+			quarantined[i].TestSuiteName = []string{}
+		}
+	}
+
+	return quarantined
+}
@@ -0,0 +1,60 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/flakiness"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_UpdateFlakinessHistory(t *testing.T) {
+	artifacts := testResultArtifacts("flakiness-history", "app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml")
+
+	historyDir := t.TempDir()
+	history := &flakiness.History{Version: 1, Builds: flakiness.MinBuilds - 1, Tests: []flakiness.TestHistory{
+		{TestID: flakiness.TestID{TestSuiteName: "app-debug", ClassName: "io.bitrise.sample.ParserTest", Method: "parsesEmptyInput"}, Outcomes: "PPPPPPPPP", LastBuild: 9},
+		{TestID: flakiness.TestID{TestSuiteName: "app-debug", ClassName: "io.bitrise.sample.ParserTest", Method: "parsesDecimal"}, Outcomes: "PPPPPPPPP", LastBuild: 9},
+		// The same test case, flaky in the results of an unknown layout.
+		{TestID: flakiness.TestID{ClassName: "io.bitrise.sample.ParserTest", Method: "parsesDecimal"}, Outcomes: "MMMMMMMM", LastBuild: 9},
+	}}
+	require.NoError(t, history.Save(historyDir))
+
+	logger := mocks.NewLogger(t)
+	logger.On("Printf", mock.Anything, 2, 3).Return()
+	// The test case of the unknown layout ran in fewer than MinBuilds builds, so it is not reported.
+	logger.On("Warnf", mock.Anything, 1, 10.0).Return()
+	logger.On("Printf", mock.Anything, "io.bitrise.sample.ParserTest", "parsesDecimal", "app-debug", 10.0, 10).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", flakyTestsQuarantineEnvVarKey, `[{"testCaseName":"parsesDecimal","testSuiteName":["app-debug"],"className":"io.bitrise.sample.ParserTest"}]`).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.UpdateFlakinessHistory(historyDir, 0.1, artifacts, nil)
+	require.NoError(t, err)
+
+	history, err = flakiness.Load(historyDir)
+	require.NoError(t, err)
+	require.Equal(t, []flakiness.TestHistory{
+		{TestID: flakiness.TestID{ClassName: "io.bitrise.sample.ParserTest", Method: "parsesDecimal"}, Outcomes: "MMMMMMMM", LastBuild: 9},
+		{TestID: flakiness.TestID{TestSuiteName: "app-debug", ClassName: "io.bitrise.sample.ParserTest", Method: "parsesDecimal"}, Outcomes: "PPPPPPPPPM", LastBuild: 10},
+		{TestID: flakiness.TestID{TestSuiteName: "app-debug", ClassName: "io.bitrise.sample.ParserTest", Method: "parsesEmptyInput"}, Outcomes: "PPPPPPPPPP", LastBuild: 10},
+	}, history.Tests)
+}
+
+func Test_quarantinedTests(t *testing.T) {
+	got := quarantinedTests([]flakiness.FlakyTest{
+		{TestID: flakiness.TestID{TestSuiteName: "app-debug", ClassName: "com.acme.ParserTest", Method: "parses"}},
+		{TestID: flakiness.TestID{TestSuiteName: "lib-release", ClassName: "com.acme.ParserTest", Method: "parses"}},
+		{TestID: flakiness.TestID{TestSuiteName: "app-debug", ClassName: "com.acme.FormatterTest", Method: "formats"}},
+	})
+	require.Len(t, got, 2)
+	require.Equal(t, []string{"app-debug", "lib-release"}, got[0].TestSuiteName)
+	require.Equal(t, "com.acme.FormatterTest", got[1].ClassName)
+	require.Equal(t, []string{"app-debug"}, got[1].TestSuiteName)
+}
@@ -0,0 +1,248 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+)
+
+const (
+	flakyTestsReportFileName      = "flaky-tests.json"
+	flakyTestsReportPathEnvVarKey = "BITRISE_FLAKY_TESTS_REPORT_PATH"
+)
+
+// FlakyTestsReport is the machine-readable report of the flaky test cases, written to the deploy dir.
+type FlakyTestsReport struct {
+	FlakyTests []FlakyTest `json:"flaky_tests"`
+}
+
+// FlakyTest is a test case, which both passed and failed in the same module and variant.
+type FlakyTest struct {
+	Module          string   `json:"module"`
+	Variant         string   `json:"variant"`
+	ClassName       string   `json:"class_name"`
+	Method          string   `json:"method"`
+	Passed          int      `json:"passed"`
+	Failed          int      `json:"failed"`
+	FailureMessages []string `json:"failure_messages"`
+}
+
+// testCaseKey identifies a test case across the result XMLs of a module and variant.
+type testCaseKey struct {
+	Module    string
+	Variant   string
+	ClassName string
+	Name      string
+}
+
+type testCaseResults struct {
+	SuiteName       string
+	Passed          int
+	Failed          int
+	Skipped         int
+	Errored         int
+	Time            float64
+	FailureMessages []string
+	// StackTrace is the failure (or error) details of the first failed execution.
+	StackTrace string
+	// Executions are the executions of the test case in the order of the test results.
+	Executions []testreport.TestCase
+}
+
+func (r testCaseResults) isFlaky() bool {
+	return r.Passed > 0 && r.Failed > 0
+}
+
+// isFailed reports whether every execution of the test case failed, flaky test cases passed in the end.
+func (r testCaseResults) isFailed() bool {
+	return r.Passed == 0 && r.Failed > 0
+}
+
+// isSkipped reports whether the test case was skipped in every execution.
+func (r testCaseResults) isSkipped() bool {
+	return r.Passed == 0 && r.Failed == 0
+}
+
+// ExportFlakyTestsReport writes every flaky test case (without the size limit of the BITRISE_FLAKY_TEST_CASES env var)
+// into a JSON report in the deploy dir, and exports the report's path in the BITRISE_FLAKY_TESTS_REPORT_PATH env var.
+func (e exporter) ExportFlakyTestsReport(deployDir string, artifacts []gradle.Artifact) error {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	report := FlakyTestsReport{FlakyTests: []FlakyTest{}}
+	for _, key := range keys {
+		result := results[key]
+		if !result.isFlaky() {
+			continue
+		}
+
+		report.FlakyTests = append(report.FlakyTests, FlakyTest{
+			Module:          key.Module,
+			Variant:         key.Variant,
+			ClassName:       key.ClassName,
+			Method:          key.Name,
+			Passed:          result.Passed,
+			Failed:          result.Failed,
+			FailureMessages: result.FailureMessages,
+		})
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal flaky tests report: %w", err)
+	}
+
+	reportPth := filepath.Join(deployDir, flakyTestsReportFileName)
+	if err := os.WriteFile(reportPth, content, 0o644); err != nil {
+		return fmt.Errorf("failed to write flaky tests report (%s): %w", reportPth, err)
+	}
+
+	e.logger.Donef("%d flaky test case(s) written to %s, exporting %s env var", len(report.FlakyTests), reportPth, flakyTestsReportPathEnvVarKey)
+
+	if err := e.envRepository.Set(flakyTestsReportPathEnvVarKey, reportPth); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", flakyTestsReportPathEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to export flaky tests report:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+// collectTestCaseResults counts the passed, failed and skipped executions of every test case over the union of the result XMLs
+// of a module and variant, including the test cases of nested test suites. Keys are returned in the order of appearance.
+// The executions of a test case are in the order of the retried attempts, followed by the execution of the last attempt.
+func (e exporter) collectTestCaseResults(artifacts []gradle.Artifact) ([]testCaseKey, map[testCaseKey]*testCaseResults, []error) {
+	var keys []testCaseKey
+	results := map[testCaseKey]*testCaseResults{}
+	var errs []error
+
+	for _, artifact := range slices.Concat(groupAttemptResults(artifacts)...) {
+		testReport, err := e.convertTestReport(artifact.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err))
+			continue
+		}
+
+		// Results outside of the <module>/build/test-results/test<Variant>UnitTest layout are merged together.
+		module, variant, err := testaddon.ModuleAndVariant(artifact.Path)
+		if err != nil {
+			module, variant = "", ""
+		}
+
+		for _, suite := range testReport.TestSuites {
+			keys = addTestCaseResults(module, variant, suite, keys, results)
+		}
+	}
+
+	return keys, results, errs
+}
+
+func addTestCaseResults(module, variant string, suite testreport.TestSuite, keys []testCaseKey, results map[testCaseKey]*testCaseResults) []testCaseKey {
+	for _, testCase := range suite.TestCases {
+		key := testCaseKey{Module: module, Variant: variant, ClassName: testCase.ClassName, Name: testCase.Name}
+		result, ok := results[key]
+		if !ok {
+			result = &testCaseResults{SuiteName: suite.Name}
+			results[key] = result
+			keys = append(keys, key)
+		}
+
+		result.Time += testCase.Time
+		result.Executions = append(result.Executions, testCase)
+		if testCase.Skipped != nil {
+			result.Skipped++
+		} else if message, failed := failureMessage(testCase); failed {
+			result.Failed++
+			if testCase.Failure == nil {
+				result.Errored++
+			}
+			if result.StackTrace == "" {
+				result.StackTrace = stackTrace(testCase)
+			}
+			if message != "" && !slices.Contains(result.FailureMessages, message) {
+				result.FailureMessages = append(result.FailureMessages, message)
+			}
+		} else {
+			result.Passed++
+		}
+	}
+
+	for _, childSuite := range suite.TestSuites {
+		keys = addTestCaseResults(module, variant, childSuite, keys, results)
+	}
+
+	return keys
+}
+
+// flakyTestSuites groups the test cases, which both passed and failed, by the name of their test suite.
+func flakyTestSuites(keys []testCaseKey, results map[testCaseKey]*testCaseResults) []testreport.TestSuite {
+	return groupTestSuites(keys, results, testCaseResults.isFlaky)
+}
+
+// groupTestSuites groups the test cases matching the filter by the name of their test suite.
+func groupTestSuites(keys []testCaseKey, results map[testCaseKey]*testCaseResults, filter func(testCaseResults) bool) []testreport.TestSuite {
+	var suites []testreport.TestSuite
+	suiteIndexes := map[string]int{}
+
+	for _, key := range keys {
+		result := results[key]
+		if !filter(*result) {
+			continue
+		}
+
+		i, ok := suiteIndexes[result.SuiteName]
+		if !ok {
+			i = len(suites)
+			suiteIndexes[result.SuiteName] = i
+			suites = append(suites, testreport.TestSuite{Name: result.SuiteName})
+		}
+		suites[i].TestCases = append(suites[i].TestCases, testreport.TestCase{
+			Name:      key.Name,
+			ClassName: key.ClassName,
+		})
+	}
+
+	return suites
+}
+
+// failureMessage returns the message of the test case's failure (or error), falling back to the first line of its stack trace.
+func failureMessage(testCase testreport.TestCase) (string, bool) {
+	var message, value string
+	switch {
+	case testCase.Failure != nil:
+		message, value = testCase.Failure.Message, testCase.Failure.Value
+	case testCase.Error != nil:
+		message, value = testCase.Error.Message, testCase.Error.Value
+	default:
+		return "", false
+	}
+
+	if message == "" {
+		message, _, _ = strings.Cut(strings.TrimSpace(value), "\n")
+	}
+	return strings.TrimSpace(message), true
+}
+
+// stackTrace returns the details (usually the stack trace) of the test case's failure (or error).
+func stackTrace(testCase testreport.TestCase) string {
+	switch {
+	case testCase.Failure != nil:
+		return strings.TrimSpace(testCase.Failure.Value)
+	case testCase.Error != nil:
+		return strings.TrimSpace(testCase.Error.Value)
+	default:
+		return ""
+	}
+}
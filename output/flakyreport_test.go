@@ -0,0 +1,55 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportFlakyTestsReport(t *testing.T) {
+	artifacts := testResultArtifacts("flaky-report",
+		"app/build/test-results/testFreeDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		// The same test case failed in the release variant, but it is a different test suite.
+		"app/build/test-results/testFreeReleaseUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+	)
+
+	deployDir := t.TempDir()
+	reportPth := filepath.Join(deployDir, flakyTestsReportFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Donef", mock.Anything, 1, reportPth, flakyTestsReportPathEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", flakyTestsReportPathEnvVarKey, reportPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportFlakyTestsReport(deployDir, artifacts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(reportPth)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+  "flaky_tests": [
+    {
+      "module": "app",
+      "variant": "freeDebug",
+      "class_name": "io.bitrise.sample.ParserTest",
+      "method": "parsesDecimal",
+      "passed": 1,
+      "failed": 2,
+      "failure_messages": [
+        "java.lang.AssertionError: expected:<1.5> but was:<1.0>",
+        "java.lang.AssertionError: timed out"
+      ]
+    }
+  ]
+}`, string(content))
+}
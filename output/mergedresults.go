@@ -0,0 +1,204 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/retry"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+)
+
+const (
+	mergedTestResultsFileName      = "merged-test-results.xml"
+	mergedTestResultsPathEnvVarKey = "BITRISE_MERGED_TEST_RESULTS_PATH"
+)
+
+// mergedTestReport is a JUnit XML document with the aggregated counts and time of its test suites.
+type mergedTestReport struct {
+	XMLName    xml.Name               `xml:"testsuites"`
+	Tests      int                    `xml:"tests,attr"`
+	Failures   int                    `xml:"failures,attr"`
+	Errors     int                    `xml:"errors,attr"`
+	Skipped    int                    `xml:"skipped,attr"`
+	Time       float64                `xml:"time,attr"`
+	TestSuites []testreport.TestSuite `xml:"testsuite"`
+}
+
+// ExportMergedTestResults merges the JUnit XML results into a single testsuites document in the deploy dir,
+// and exports its path in the BITRISE_MERGED_TEST_RESULTS_PATH env var.
+// Test suites are prefixed with the <module>-<variant> name of the unit test task, so that their names stay unique,
+// and the counts and times of the test suites are recomputed from their test cases.
+// The results of the retried attempts (-attempt<N>.xml) are folded into the final result of their test suite,
+// so every test case is reported once, with the outcome of its last execution.
+func (e exporter) ExportMergedTestResults(deployDir string, artifacts []gradle.Artifact) error {
+	var errs []error
+	report := mergedTestReport{TestSuites: []testreport.TestSuite{}}
+
+	for _, attemptArtifacts := range groupAttemptResults(artifacts) {
+		var suites []testreport.TestSuite
+		for _, artifact := range attemptArtifacts {
+			testReport, err := e.convertTestReport(artifact.Path)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err))
+				continue
+			}
+
+			suites = foldTestSuites(suites, testReport.TestSuites)
+		}
+
+		prefix := testaddon.TestSuiteName(attemptArtifacts[0].Path)
+		if prefix == "" {
+			prefix = testaddon.OtherDirName
+		}
+
+		for _, suite := range suites {
+			suite = aggregateTestSuite(suite)
+			suite.Name = prefix + "/" + suite.Name
+
+			report.Tests += suite.Tests
+			report.Failures += suite.Failures
+			report.Errors += suite.Errors
+			report.Skipped += suite.Skipped
+			report.Time = roundTestTime(report.Time + suite.Time)
+			report.TestSuites = append(report.TestSuites, suite)
+		}
+	}
+
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal merged test results: %w", err)
+	}
+
+	mergedPth := filepath.Join(deployDir, mergedTestResultsFileName)
+	if err := os.WriteFile(mergedPth, append([]byte(xml.Header), content...), 0o644); err != nil {
+		return fmt.Errorf("failed to write merged test results (%s): %w", mergedPth, err)
+	}
+
+	e.logger.Donef("%d test suite(s) merged into %s, exporting %s env var", len(report.TestSuites), mergedPth, mergedTestResultsPathEnvVarKey)
+
+	if err := e.envRepository.Set(mergedTestResultsPathEnvVarKey, mergedPth); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", mergedTestResultsPathEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to merge %d/%d test artifacts:\n%s", len(errs), len(artifacts), errMsg)
+	}
+
+	return nil
+}
+
+// groupAttemptResults groups the results of every attempt of a test result file (see retry.ParseAttemptResultPath),
+// in the order of the attempts with the result of the last attempt (without an attempt suffix) at the end.
+// The groups are in the order of their first result in the artifacts.
+func groupAttemptResults(artifacts []gradle.Artifact) [][]gradle.Artifact {
+	var groups [][]gradle.Artifact
+	groupIndexes := map[string]int{}
+
+	for _, artifact := range artifacts {
+		originalPath, _, _ := retry.ParseAttemptResultPath(artifact.Path)
+		i, ok := groupIndexes[originalPath]
+		if !ok {
+			i = len(groups)
+			groupIndexes[originalPath] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], artifact)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			return attemptOrder(group[i].Path) < attemptOrder(group[j].Path)
+		})
+	}
+
+	return groups
+}
+
+// attemptOrder returns the attempt of the test result, the result of the last attempt is ordered after every other attempt.
+func attemptOrder(pth string) int {
+	if _, attempt, ok := retry.ParseAttemptResultPath(pth); ok {
+		return attempt
+	}
+	return math.MaxInt
+}
+
+// foldTestSuites folds the test suites of a later attempt into the test suites of the previous attempts:
+// the test cases which ran again replace their previous executions.
+func foldTestSuites(suites, laterSuites []testreport.TestSuite) []testreport.TestSuite {
+	for _, laterSuite := range laterSuites {
+		i := slices.IndexFunc(suites, func(suite testreport.TestSuite) bool {
+			return suite.Name == laterSuite.Name
+		})
+		if i == -1 {
+			suites = append(suites, laterSuite)
+			continue
+		}
+
+		type testCaseKey struct{ ClassName, Name string }
+		rerun := map[testCaseKey]bool{}
+		for _, testCase := range laterSuite.TestCases {
+			rerun[testCaseKey{testCase.ClassName, testCase.Name}] = true
+		}
+
+		var testCases []testreport.TestCase
+		for _, testCase := range suites[i].TestCases {
+			if !rerun[testCaseKey{testCase.ClassName, testCase.Name}] {
+				testCases = append(testCases, testCase)
+			}
+		}
+		suites[i].TestCases = append(testCases, laterSuite.TestCases...)
+		suites[i].TestSuites = foldTestSuites(suites[i].TestSuites, laterSuite.TestSuites)
+	}
+	return suites
+}
+
+// aggregateTestSuite recomputes the counts and the time of the test suite (and its nested test suites) from its test cases.
+func aggregateTestSuite(suite testreport.TestSuite) testreport.TestSuite {
+	suite.Tests, suite.Failures, suite.Errors, suite.Skipped, suite.Time = 0, 0, 0, 0, 0
+
+	for _, testCase := range suite.TestCases {
+		suite.Tests++
+		suite.Time += testCase.Time
+
+		switch {
+		case testCase.Skipped != nil:
+			suite.Skipped++
+		case testCase.Failure != nil:
+			suite.Failures++
+		case testCase.Error != nil:
+			suite.Errors++
+		}
+	}
+
+	childSuites := make([]testreport.TestSuite, 0, len(suite.TestSuites))
+	for _, childSuite := range suite.TestSuites {
+		childSuite = aggregateTestSuite(childSuite)
+
+		suite.Tests += childSuite.Tests
+		suite.Failures += childSuite.Failures
+		suite.Errors += childSuite.Errors
+		suite.Skipped += childSuite.Skipped
+		suite.Time += childSuite.Time
+		childSuites = append(childSuites, childSuite)
+	}
+	suite.TestSuites = childSuites
+	suite.Time = roundTestTime(suite.Time)
+
+	return suite
+}
+
+// roundTestTime rounds the sum of test times to milliseconds, to avoid floating point noise in the XML.
+func roundTestTime(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
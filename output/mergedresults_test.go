@@ -0,0 +1,105 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportMergedTestResults(t *testing.T) {
+	// The reported counts and times are wrong on purpose, the merged ones are recomputed.
+	artifacts := testResultArtifacts("merged",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"app/build/test-results/testReleaseUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+	)
+
+	deployDir := t.TempDir()
+	mergedPth := filepath.Join(deployDir, mergedTestResultsFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Donef", mock.Anything, 2, mergedPth, mergedTestResultsPathEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", mergedTestResultsPathEnvVarKey, mergedPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportMergedTestResults(deployDir, artifacts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(mergedPth)
+	require.NoError(t, err)
+	want, err := os.ReadFile(filepath.Join("testdata", "merged-test-results.xml"))
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(content))
+
+	// The merged file is a valid JUnit XML, which can be converted again.
+	converter := junitxml.Converter{}
+	require.True(t, converter.Detect([]string{mergedPth}))
+	testReport, err := converter.Convert()
+	require.NoError(t, err)
+	require.Len(t, testReport.TestSuites, 2)
+}
+
+func Test_exporter_ExportMergedTestResults_attempts(t *testing.T) {
+	// The failed test cases of ParserTest were retried twice, FormatterTest did not run in the retries.
+	artifacts := testResultArtifacts("attempts",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.FormatterTest-attempt1.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest-attempt2.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest-attempt1.xml",
+	)
+
+	deployDir := t.TempDir()
+	mergedPth := filepath.Join(deployDir, mergedTestResultsFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Donef", mock.Anything, 2, mergedPth, mergedTestResultsPathEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", mergedTestResultsPathEnvVarKey, mergedPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportMergedTestResults(deployDir, artifacts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(mergedPth)
+	require.NoError(t, err)
+	want, err := os.ReadFile(filepath.Join("testdata", "merged-attempt-test-results.xml"))
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(content))
+}
+
+func Test_groupAttemptResults(t *testing.T) {
+	resultsDir := filepath.Join("app", "build", "test-results", "testDebugUnitTest")
+	parserTest := func(name string) gradle.Artifact {
+		return gradle.Artifact{Path: filepath.Join(resultsDir, name)}
+	}
+
+	require.Equal(t, [][]gradle.Artifact{
+		{
+			parserTest("TEST-io.bitrise.sample.ParserTest-attempt1.xml"),
+			parserTest("TEST-io.bitrise.sample.ParserTest-attempt2.xml"),
+			parserTest("TEST-io.bitrise.sample.ParserTest-attempt10.xml"),
+			parserTest("TEST-io.bitrise.sample.ParserTest.xml"),
+		},
+		{parserTest("TEST-io.bitrise.sample.FormatterTest.xml")},
+	}, groupAttemptResults([]gradle.Artifact{
+		parserTest("TEST-io.bitrise.sample.ParserTest-attempt10.xml"),
+		parserTest("TEST-io.bitrise.sample.ParserTest.xml"),
+		parserTest("TEST-io.bitrise.sample.FormatterTest.xml"),
+		parserTest("TEST-io.bitrise.sample.ParserTest-attempt2.xml"),
+		parserTest("TEST-io.bitrise.sample.ParserTest-attempt1.xml"),
+	}))
+}
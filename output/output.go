@@ -11,6 +11,8 @@ import (
 	"github.com/bitrise-io/go-utils/v2/env"
 	"github.com/bitrise-io/go-utils/v2/log"
 	"github.com/bitrise-io/go-utils/v2/pathutil"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/coverage"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
 	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
 	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
 	"github.com/bitrise-io/go-steputils/v2/testreport"
@@ -25,6 +27,18 @@ type Exporter interface {
 	ExportArtifacts(deployDir string, artifacts []gradle.Artifact) error
 	ExportTestAddonArtifacts(testDeployDir string, artifacts []gradle.Artifact) ([]gradle.Artifact, error)
 	ExportFlakyTestsEnvVar(artifacts []gradle.Artifact) error
+	ExportFlakyTestsReport(deployDir string, artifacts []gradle.Artifact) error
+	ReportFailedTests(artifacts []gradle.Artifact, maxLines int) error
+	ExportFailedTestCases(deployDir string, artifacts []gradle.Artifact) error
+	ExportTestSummary(deployDir string, artifacts []gradle.Artifact) error
+	ExportMergedTestResults(deployDir string, artifacts []gradle.Artifact) error
+	ExportCTRFReport(deployDir string, artifacts []gradle.Artifact, start, stop time.Time) error
+	ExportCoverage(reports []coverage.Report) error
+	ExportTestCounts(artifacts []gradle.Artifact, quarantinedTests []gradleconfig.TestPattern, testSuiteNames []string, wallTime time.Duration) error
+	UpdateFlakinessHistory(historyDir string, threshold float64, artifacts, quarantinedArtifacts []gradle.Artifact) error
+	ReportUnmatchedTestFilters(patterns []gradleconfig.TestPattern, artifacts []gradle.Artifact) error
+	ReportStaleQuarantinedTests(quarantinedTests []gradleconfig.TestPattern, testClasses map[string][]string, artifacts []gradle.Artifact) error
+	ReportQuarantinedTestResults(quarantinedTests []gradleconfig.TestPattern, artifacts []gradle.Artifact, historyDir string) error
 }
 
 type exporter struct {
@@ -101,26 +115,18 @@ func (e exporter) ExportTestAddonArtifacts(testDeployDir string, artifacts []gra
 	return exportedArtifacts, nil
 }
 
+// ExportFlakyTestsEnvVar detects the flaky test cases of the test results and exports them in the BITRISE_FLAKY_TEST_CASES env var.
+// Test cases are identified by their module, variant, class and method name, and checked over the union of the result XMLs
+// (including the results of retried attempts and nested test suites), so that a test case failing in one execution
+// and passing in another is considered flaky.
 func (e exporter) ExportFlakyTestsEnvVar(artifacts []gradle.Artifact) error {
 	if len(artifacts) == 0 {
 		return nil
 	}
 
-	var exportErrs []error
-	var flakyTestSuites []testreport.TestSuite
-
-	for _, artifact := range artifacts {
-		testReport, err := e.convertTestReport(artifact.Path)
-		if err != nil {
-			exportErrs = append(exportErrs, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err))
-			continue
-		}
-
-		testSuites := e.getFlakyTestSuites(testReport)
-		flakyTestSuites = append(flakyTestSuites, testSuites...)
-	}
+	keys, results, exportErrs := e.collectTestCaseResults(artifacts)
 
-	if err := e.exportFlakyTestCasesEnvVar(flakyTestSuites); err != nil {
+	if err := e.exportFlakyTestCasesEnvVar(flakyTestSuites(keys, results)); err != nil {
 		exportErrs = append(exportErrs, fmt.Errorf("failed to export flaky test cases env var: %w", err))
 	}
 
@@ -157,47 +163,13 @@ func (e exporter) convertTestReport(pth string) (testreport.TestReport, error) {
 }
 
 func (e exporter) getFlakyTestSuites(testReport testreport.TestReport) []testreport.TestSuite {
-	var flakyTestSuites []testreport.TestSuite
-
+	var keys []testCaseKey
+	results := map[testCaseKey]*testCaseResults{}
 	for _, suite := range testReport.TestSuites {
-		var flakyTests []testreport.TestCase
-		testCasesToStatus := map[string]bool{}
-		alreadySeenFlakyTests := map[string]bool{}
-
-		for _, testCase := range suite.TestCases {
-			testCaseID := testCase.ClassName + "." + testCase.Name
-
-			newIsFailed := false
-			if testCase.Failure != nil {
-				newIsFailed = true
-			}
-
-			previousIsFailed, alreadySeen := testCasesToStatus[testCaseID]
-			if !alreadySeen {
-				testCasesToStatus[testCaseID] = newIsFailed
-			} else {
-				_, seen := alreadySeenFlakyTests[testCaseID]
-				if !seen && (previousIsFailed != newIsFailed) {
-					flakyTests = append(flakyTests, testreport.TestCase{
-						XMLName:   testCase.XMLName,
-						Name:      testCase.Name,
-						ClassName: testCase.ClassName,
-					})
-					alreadySeenFlakyTests[testCaseID] = true
-				}
-			}
-		}
-
-		if len(flakyTests) > 0 {
-			flakyTestSuites = append(flakyTestSuites, testreport.TestSuite{
-				XMLName:   suite.XMLName,
-				Name:      suite.Name,
-				TestCases: flakyTests,
-			})
-		}
+		keys = addTestCaseResults("", "", suite, keys, results)
 	}
 
-	return flakyTestSuites
+	return flakyTestSuites(keys, results)
 }
 
 func (e exporter) exportFlakyTestCasesEnvVar(flakyTestSuites []testreport.TestSuite) error {
@@ -205,10 +177,25 @@ func (e exporter) exportFlakyTestCasesEnvVar(flakyTestSuites []testreport.TestSu
 		return nil
 	}
 
-	storedFlakyTestCases := map[string]bool{}
-	var flakyTestCases []string
+	flakyTestCases := testCaseNames(flakyTestSuites)
+	if len(flakyTestCases) > 0 {
+		e.logger.Donef("%d flaky test case(s) detected, exporting %s env var", len(flakyTestCases), flakyTestCasesEnvVarKey)
+	}
+
+	flakyTestCasesMessage := e.testCasesEnvVarValue(flakyTestCasesEnvVarKey, flakyTestCasesEnvVarSizeLimitInBytes, flakyTestCases)
+	if err := e.envRepository.Set(flakyTestCasesEnvVarKey, flakyTestCasesMessage); err != nil {
+		return fmt.Errorf("failed to export %s: %w", flakyTestCasesEnvVarKey, err)
+	}
+
+	return nil
+}
+
+// testCaseNames returns the unique <suite>.<class>.<method> names of the test cases.
+func testCaseNames(testSuites []testreport.TestSuite) []string {
+	storedTestCases := map[string]bool{}
+	var testCases []string
 
-	for _, testSuite := range flakyTestSuites {
+	for _, testSuite := range testSuites {
 		for _, testCase := range testSuite.TestCases {
 			testCaseName := testCase.Name
 			if len(testCase.ClassName) > 0 {
@@ -219,32 +206,29 @@ func (e exporter) exportFlakyTestCasesEnvVar(flakyTestSuites []testreport.TestSu
 				testCaseName = testSuite.Name + "." + testCaseName
 			}
 
-			if _, stored := storedFlakyTestCases[testCaseName]; !stored {
-				storedFlakyTestCases[testCaseName] = true
-				flakyTestCases = append(flakyTestCases, testCaseName)
+			if _, stored := storedTestCases[testCaseName]; !stored {
+				storedTestCases[testCaseName] = true
+				testCases = append(testCases, testCaseName)
 			}
 		}
 	}
 
-	if len(flakyTestCases) > 0 {
-		e.logger.Donef("%d flaky test case(s) detected, exporting %s env var", len(flakyTestCases), flakyTestCasesEnvVarKey)
-	}
+	return testCases
+}
 
-	var flakyTestCasesMessage string
-	for i, flakyTestCase := range flakyTestCases {
-		flakyTestCasesMessageLine := fmt.Sprintf("- %s\n", flakyTestCase)
+// testCasesEnvVarValue lists the test cases as "- <test case>" lines, up to the env var size limit.
+func (e exporter) testCasesEnvVarValue(envVarKey string, sizeLimitInBytes int, testCases []string) string {
+	var message string
+	for i, testCase := range testCases {
+		line := fmt.Sprintf("- %s\n", testCase)
 
-		if len(flakyTestCasesMessage)+len(flakyTestCasesMessageLine) > flakyTestCasesEnvVarSizeLimitInBytes {
-			e.logger.Warnf("%s env var size limit (%d characters) exceeded. Skipping %d test cases.", flakyTestCasesEnvVarKey, flakyTestCasesEnvVarSizeLimitInBytes, len(flakyTestCases)-i)
+		if len(message)+len(line) > sizeLimitInBytes {
+			e.logger.Warnf("%s env var size limit (%d characters) exceeded. Skipping %d test cases.", envVarKey, sizeLimitInBytes, len(testCases)-i)
 			break
 		}
 
-		flakyTestCasesMessage += flakyTestCasesMessageLine
+		message += line
 	}
 
-	if err := e.envRepository.Set(flakyTestCasesEnvVarKey, flakyTestCasesMessage); err != nil {
-		return fmt.Errorf("failed to export %s: %w", flakyTestCasesEnvVarKey, err)
-	}
-
-	return nil
+	return message
 }
@@ -36,6 +36,58 @@ func Test_exporter_ExportFlakyTestsEnvVar(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func Test_exporter_ExportFlakyTestsEnvVar_retriedAttempts(t *testing.T) {
+	artifacts := testResultArtifacts("attempts",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest-attempt1.xml",
+	)
+
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", flakyTestCasesEnvVarKey, "- io.bitrise.sample.ParserTest.io.bitrise.sample.ParserTest.parsesDecimal\n").Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		pathChecker:   pathutil.NewPathChecker(),
+		logger:        log.NewLogger(),
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportFlakyTestsEnvVar(artifacts)
+	require.NoError(t, err)
+}
+
+func Test_exporter_ExportFlakyTestsEnvVar_separateResultFiles(t *testing.T) {
+	artifacts := testResultArtifacts("separate-results",
+		// Flaky: failed and passed in separate result files of the same module and variant.
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"app/build/test-results/testDebugUnitTest/rerun/TEST-io.bitrise.sample.ParserTest.xml",
+		// Not flaky: the same test case failed in another variant and another module only.
+		"app/build/test-results/testReleaseUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"lib/build/test-results/testReleaseUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+	)
+
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", flakyTestCasesEnvVarKey, "- io.bitrise.sample.ParserTest.io.bitrise.sample.ParserTest.parsesDecimal\n").Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		pathChecker:   pathutil.NewPathChecker(),
+		logger:        log.NewLogger(),
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportFlakyTestsEnvVar(artifacts)
+	require.NoError(t, err)
+
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+	require.Empty(t, errs)
+	var flakyKeys []testCaseKey
+	for _, key := range keys {
+		if results[key].isFlaky() {
+			flakyKeys = append(flakyKeys, key)
+		}
+	}
+	require.Equal(t, []testCaseKey{{Module: "app", Variant: "debug", ClassName: "io.bitrise.sample.ParserTest", Name: "parsesDecimal"}}, flakyKeys)
+}
+
 func Test_exporter_getFlakyTestSuites(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -81,6 +133,78 @@ func Test_exporter_getFlakyTestSuites(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Test-retry plugin executions with errors and skipped test cases",
+			testReport: testreport.TestReport{
+				TestSuites: []testreport.TestSuite{
+					{
+						Name: "Suite1",
+						TestCases: []testreport.TestCase{
+							{ClassName: "com.example.TestClass", Name: "testMethod1", Error: &testreport.Error{Value: "IllegalStateException"}},
+							{ClassName: "com.example.TestClass", Name: "testMethod1", Error: &testreport.Error{Value: "IllegalStateException"}},
+							{ClassName: "com.example.TestClass", Name: "testMethod1"},
+							{ClassName: "com.example.TestClass", Name: "testMethod2", Failure: &testreport.Failure{Value: "Test failed"}},
+							{ClassName: "com.example.TestClass", Name: "testMethod2", Failure: &testreport.Failure{Value: "Test failed"}},
+							{ClassName: "com.example.TestClass", Name: "testMethod3", Skipped: &testreport.Skipped{}},
+							{ClassName: "com.example.TestClass", Name: "testMethod3"},
+						},
+					},
+				},
+			},
+			want: []testreport.TestSuite{
+				{
+					Name: "Suite1",
+					TestCases: []testreport.TestCase{
+						{
+							ClassName: "com.example.TestClass",
+							Name:      "testMethod1",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Executions in nested test suites",
+			testReport: testreport.TestReport{
+				TestSuites: []testreport.TestSuite{
+					{
+						Name: "Suite1",
+						TestCases: []testreport.TestCase{
+							{ClassName: "com.example.TestClass", Name: "testMethod1", Failure: &testreport.Failure{Value: "Test failed"}},
+						},
+						TestSuites: []testreport.TestSuite{
+							{
+								Name: "Suite1",
+								TestCases: []testreport.TestCase{
+									{ClassName: "com.example.TestClass", Name: "testMethod1"},
+								},
+							},
+							{
+								Name: "Nested",
+								TestCases: []testreport.TestCase{
+									{ClassName: "com.example.TestClass$Nested", Name: "testMethod2", Failure: &testreport.Failure{Value: "Test failed"}},
+									{ClassName: "com.example.TestClass$Nested", Name: "testMethod2"},
+								},
+							},
+						},
+					},
+				},
+			},
+			want: []testreport.TestSuite{
+				{
+					Name: "Suite1",
+					TestCases: []testreport.TestCase{
+						{ClassName: "com.example.TestClass", Name: "testMethod1"},
+					},
+				},
+				{
+					Name: "Nested",
+					TestCases: []testreport.TestCase{
+						{ClassName: "com.example.TestClass$Nested", Name: "testMethod2"},
+					},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -230,3 +354,16 @@ func Test_exporter_exportFlakyTestCasesEnvVar(t *testing.T) {
 		})
 	}
 }
+
+// testResultArtifacts returns the artifacts of the test results in a project of the testdata directory,
+// the paths are relative to the project, in the <module>/build/test-results/<task> layout of Gradle.
+func testResultArtifacts(project string, pths ...string) []gradle.Artifact {
+	_, b, _, _ := runtime.Caller(0)
+	projectDir := filepath.Join(filepath.Dir(b), "testdata", project)
+
+	var artifacts []gradle.Artifact
+	for _, pth := range pths {
+		artifacts = append(artifacts, gradle.Artifact{Path: filepath.Join(projectDir, filepath.FromSlash(pth))})
+	}
+	return artifacts
+}
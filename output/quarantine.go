@@ -0,0 +1,245 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/flakiness"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+)
+
+const staleQuarantinedTestsEnvVarKey = "BITRISE_STALE_QUARANTINED_TESTS"
+
+// ReportStaleQuarantinedTests reports the quarantined tests, which match neither a compiled test class nor a test case
+// of the test results, and exports them in the BITRISE_STALE_QUARANTINED_TESTS env var.
+//
+// The testClasses are the compiled test classes by the <module>-<variant> name of the executed test suites.
+// A quarantined test is only checked against the classes of the test suites it applies to, quarantined tests
+// which apply to no executed test suite with compiled test classes are reported as not checked.
+func (e exporter) ReportStaleQuarantinedTests(quarantinedTests []gradleconfig.TestPattern, testClasses map[string][]string, artifacts []gradle.Artifact) error {
+	if len(quarantinedTests) == 0 {
+		return nil
+	}
+
+	matched := make([]bool, len(quarantinedTests))
+	var errs []error
+	for _, artifact := range artifacts {
+		testReport, err := e.convertTestReport(artifact.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err))
+			continue
+		}
+
+		testSuiteName := testaddon.TestSuiteName(artifact.Path)
+		for _, suite := range testReport.TestSuites {
+			markMatchedQuarantinedTests(suite, testSuiteName, quarantinedTests, matched)
+		}
+	}
+
+	var stale, notChecked []string
+	seen := map[string]bool{}
+	for i, pattern := range quarantinedTests {
+		label := testPatternLabel(pattern)
+		if matched[i] || seen[label] {
+			continue
+		}
+		seen[label] = true
+
+		checked := false
+		for testSuiteName, classes := range testClasses {
+			if !gradleconfig.AppliesToTestSuite(pattern, testSuiteName) {
+				continue
+			}
+			checked = true
+
+			if slices.ContainsFunc(classes, func(className string) bool {
+				return gradleconfig.MatchesTestClass(pattern.Pattern, className)
+			}) {
+				matched[i] = true
+				break
+			}
+		}
+
+		switch {
+		case matched[i]:
+		case checked:
+			stale = append(stale, label)
+		default:
+			notChecked = append(notChecked, label)
+		}
+	}
+
+	staleQuarantinedTestsMessage := ""
+	if len(stale) == 0 {
+		e.logger.Donef("Every checked quarantined test matched at least one test")
+	} else {
+		e.logger.Warnf("%d/%d quarantined test(s) matched no test, consider removing them from the quarantine:", len(stale), len(quarantinedTests))
+		for _, label := range stale {
+			e.logger.Warnf("- %s", label)
+			staleQuarantinedTestsMessage += fmt.Sprintf("- %s\n", label)
+		}
+	}
+	if len(notChecked) > 0 {
+		e.logger.Printf("%d/%d quarantined test(s) not checked, as none of their test suites ran with compiled test classes:", len(notChecked), len(quarantinedTests))
+		for _, label := range notChecked {
+			e.logger.Printf("- %s", label)
+		}
+	}
+
+	if err := e.envRepository.Set(staleQuarantinedTestsEnvVarKey, staleQuarantinedTestsMessage); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", staleQuarantinedTestsEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to check quarantined tests:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+// markMatchedQuarantinedTests marks the quarantined tests, which match a test case of the test suite.
+// Results outside of the <module>/build/test-results/test<Variant>UnitTest layout (without a test suite name)
+// are matched against every quarantined test.
+func markMatchedQuarantinedTests(suite testreport.TestSuite, testSuiteName string, quarantinedTests []gradleconfig.TestPattern, matched []bool) {
+	for _, testCase := range suite.TestCases {
+		for i, pattern := range quarantinedTests {
+			if matched[i] || (testSuiteName != "" && !gradleconfig.AppliesToTestSuite(pattern, testSuiteName)) {
+				continue
+			}
+			if gradleconfig.MatchesTestPattern(pattern.Pattern, testCase.ClassName, testCase.Name) {
+				matched[i] = true
+			}
+		}
+	}
+
+	for _, childSuite := range suite.TestSuites {
+		markMatchedQuarantinedTests(childSuite, testSuiteName, quarantinedTests, matched)
+	}
+}
+
+// testPatternLabel returns the pattern followed by the test suites it is scoped to, if any.
+func testPatternLabel(pattern gradleconfig.TestPattern) string {
+	if len(pattern.TestSuiteNames) == 0 {
+		return pattern.Pattern
+	}
+	return fmt.Sprintf("%s (%s)", pattern.Pattern, strings.Join(pattern.TestSuiteNames, ", "))
+}
+
+// ReportQuarantinedTestResults summarizes the results of the quarantined test run: which quarantined tests passed,
+// which ones still fail and which ones did not run at all. Test cases are matched against the quarantined tests
+// of their test suite, results without a test suite name are matched against every quarantined test.
+//
+// A single passing run does not prove that a flaky test is fixed: removing a quarantined test is only suggested,
+// if each of its test cases passed in the last flakiness.MinBuilds builds of the flakiness history (if historyDir is set).
+func (e exporter) ReportQuarantinedTestResults(quarantinedTests []gradleconfig.TestPattern, artifacts []gradle.Artifact, historyDir string) error {
+	if len(quarantinedTests) == 0 {
+		return nil
+	}
+
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	var history *flakiness.History
+	if historyDir != "" {
+		var err error
+		if history, err = flakiness.Load(historyDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	passed := make([]int, len(quarantinedTests))
+	failed := make([]int, len(quarantinedTests))
+	testIDs := make([][]flakiness.TestID, len(quarantinedTests))
+	for _, key := range keys {
+		result := results[key]
+		if result.isSkipped() {
+			continue
+		}
+
+		id := key.testID()
+		for i, pattern := range quarantinedTests {
+			if id.TestSuiteName != "" && !gradleconfig.AppliesToTestSuite(pattern, id.TestSuiteName) {
+				continue
+			}
+			if !gradleconfig.MatchesTestPattern(pattern.Pattern, key.ClassName, key.Name) {
+				continue
+			}
+
+			if result.Failed > 0 {
+				failed[i]++
+			} else {
+				passed[i]++
+			}
+			testIDs[i] = append(testIDs[i], id)
+		}
+	}
+
+	var passingConsistently, passing, failing, notRun []string
+	seen := map[string]bool{}
+	for i, pattern := range quarantinedTests {
+		label := testPatternLabel(pattern)
+		if seen[label] {
+			continue
+		}
+		seen[label] = true
+
+		switch {
+		case failed[i] > 0:
+			failing = append(failing, label)
+		case passed[i] > 0 && history != nil && !slices.ContainsFunc(testIDs[i], func(id flakiness.TestID) bool {
+			return !history.PassedConsistently(id)
+		}):
+			passingConsistently = append(passingConsistently, label)
+		case passed[i] > 0:
+			passing = append(passing, label)
+		default:
+			notRun = append(notRun, label)
+		}
+	}
+
+	if len(passingConsistently) > 0 {
+		e.logger.Donef("%d/%d quarantined test(s) passed in each of the last %d builds, consider removing them from the quarantine:", len(passingConsistently), len(seen), flakiness.MinBuilds)
+		for _, label := range passingConsistently {
+			e.logger.Printf("- %s", label)
+		}
+	}
+	if len(passing) > 0 {
+		if history != nil {
+			e.logger.Printf("%d/%d quarantined test(s) passed in this run, but not yet in each of the last %d builds:", len(passing), len(seen), flakiness.MinBuilds)
+		} else {
+			e.logger.Printf("%d/%d quarantined test(s) passed in this run:", len(passing), len(seen))
+		}
+		for _, label := range passing {
+			e.logger.Printf("- %s", label)
+		}
+	}
+	if len(failing) > 0 {
+		e.logger.Warnf("%d/%d quarantined test(s) still fail:", len(failing), len(seen))
+		for _, label := range failing {
+			e.logger.Printf("- %s", label)
+		}
+	}
+	if len(notRun) > 0 {
+		e.logger.Printf("%d/%d quarantined test(s) did not run:", len(notRun), len(seen))
+		for _, label := range notRun {
+			e.logger.Printf("- %s", label)
+		}
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to check quarantined test results:\n%s", errMsg)
+	}
+
+	return nil
+}
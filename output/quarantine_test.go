@@ -0,0 +1,155 @@
+package output
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/flakiness"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ReportStaleQuarantinedTests(t *testing.T) {
+	_, b, _, _ := runtime.Caller(0)
+	testResultXML := filepath.Join(filepath.Dir(b), "testdata", "TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml")
+	testClasses := map[string][]string{
+		"app-debug": {"io.bitrise.kotlinresponsiveviewsactivity.ActivityTest", "io.bitrise.kotlinresponsiveviewsactivity.ActivityTest$Nested"},
+	}
+
+	tests := []struct {
+		name             string
+		quarantinedTests []gradleconfig.TestPattern
+		mockLogs         func(logger *mocks.Logger)
+		wantEnvVarValue  string
+	}{
+		{
+			name: "Every quarantined test matched",
+			quarantinedTests: []gradleconfig.TestPattern{
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.ActivityTest.rendersLayout"},
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.ActivityTest$Nested"},
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.UniTest.flaky", TestSuiteNames: []string{"app-release"}},
+			},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Donef", "Every checked quarantined test matched at least one test").Return()
+			},
+		},
+		{
+			name: "Stale quarantined tests are reported",
+			quarantinedTests: []gradleconfig.TestPattern{
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.ActivityTest.rendersLayout"},
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.RemovedTest"},
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.UniTest.renamed", TestSuiteNames: []string{"app-debug"}},
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.UniTest.renamed", TestSuiteNames: []string{"app-debug"}},
+			},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Warnf", "%d/%d quarantined test(s) matched no test, consider removing them from the quarantine:", 2, 4).Return()
+				logger.On("Warnf", "- %s", "io.bitrise.kotlinresponsiveviewsactivity.RemovedTest").Return()
+				logger.On("Warnf", "- %s", "io.bitrise.kotlinresponsiveviewsactivity.UniTest.renamed (app-debug)").Return()
+			},
+			wantEnvVarValue: "- io.bitrise.kotlinresponsiveviewsactivity.RemovedTest\n- io.bitrise.kotlinresponsiveviewsactivity.UniTest.renamed (app-debug)\n",
+		},
+		{
+			name: "Quarantined tests of test suites without compiled test classes are not checked",
+			quarantinedTests: []gradleconfig.TestPattern{
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.RemovedTest", TestSuiteNames: []string{"app-release"}},
+				{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.LibTest", TestSuiteNames: []string{"lib-debug"}},
+			},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Donef", "Every checked quarantined test matched at least one test").Return()
+				logger.On("Printf", "%d/%d quarantined test(s) not checked, as none of their test suites ran with compiled test classes:", 2, 2).Return()
+				logger.On("Printf", "- %s", "io.bitrise.kotlinresponsiveviewsactivity.RemovedTest (app-release)").Return()
+				logger.On("Printf", "- %s", "io.bitrise.kotlinresponsiveviewsactivity.LibTest (lib-debug)").Return()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := mocks.NewLogger(t)
+			tt.mockLogs(logger)
+			envRepository := mocks.NewRepository(t)
+			envRepository.On("Set", staleQuarantinedTestsEnvVarKey, tt.wantEnvVarValue).Return(nil)
+
+			e := exporter{
+				envRepository: envRepository,
+				logger:        logger,
+				converter:     junitxml.Converter{},
+			}
+			err := e.ReportStaleQuarantinedTests(tt.quarantinedTests, testClasses, []gradle.Artifact{{Path: testResultXML}})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func Test_exporter_ReportQuarantinedTestResults(t *testing.T) {
+	artifacts := testResultArtifacts("quarantined", "app/build/quarantined-test-results/testDebugUnitTest/TEST-io.bitrise.sample.QuarantinedTest.xml")
+	quarantinedTests := []gradleconfig.TestPattern{
+		{Pattern: "io.bitrise.sample.QuarantinedTest.fixedParser", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "io.bitrise.sample.QuarantinedTest.flakyClock"},
+		{Pattern: "io.bitrise.sample.QuarantinedTest.ignoredNetwork"},
+		// The results are of the app-debug test suite only.
+		{Pattern: "io.bitrise.sample.QuarantinedTest.fixedParser", TestSuiteNames: []string{"app-release"}},
+	}
+	fixedParserID := flakiness.TestID{TestSuiteName: "app-debug", ClassName: "io.bitrise.sample.QuarantinedTest", Method: "fixedParser"}
+
+	tests := []struct {
+		name     string
+		history  *flakiness.History
+		mockLogs func(logger *mocks.Logger)
+	}{
+		{
+			name: "Passing quarantined tests without flakiness history",
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Printf", "%d/%d quarantined test(s) passed in this run:", 1, 4).Return()
+				logger.On("Printf", "- %s", "io.bitrise.sample.QuarantinedTest.fixedParser (app-debug)").Return()
+			},
+		},
+		{
+			name: "Passing quarantined tests, which did not pass consistently",
+			history: &flakiness.History{Version: 1, Builds: 10, Tests: []flakiness.TestHistory{
+				{TestID: fixedParserID, Outcomes: "FPPPPPPPPP", LastBuild: 10},
+			}},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Printf", "%d/%d quarantined test(s) passed in this run, but not yet in each of the last %d builds:", 1, 4, flakiness.MinBuilds).Return()
+				logger.On("Printf", "- %s", "io.bitrise.sample.QuarantinedTest.fixedParser (app-debug)").Return()
+			},
+		},
+		{
+			name: "Quarantined tests passing consistently",
+			history: &flakiness.History{Version: 1, Builds: 11, Tests: []flakiness.TestHistory{
+				{TestID: fixedParserID, Outcomes: "FPPPPPPPPPP", LastBuild: 11},
+			}},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Donef", "%d/%d quarantined test(s) passed in each of the last %d builds, consider removing them from the quarantine:", 1, 4, flakiness.MinBuilds).Return()
+				logger.On("Printf", "- %s", "io.bitrise.sample.QuarantinedTest.fixedParser (app-debug)").Return()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			historyDir := ""
+			if tt.history != nil {
+				historyDir = t.TempDir()
+				require.NoError(t, tt.history.Save(historyDir))
+			}
+
+			logger := mocks.NewLogger(t)
+			tt.mockLogs(logger)
+			logger.On("Warnf", "%d/%d quarantined test(s) still fail:", 1, 4).Return()
+			logger.On("Printf", "- %s", "io.bitrise.sample.QuarantinedTest.flakyClock").Return()
+			logger.On("Printf", "%d/%d quarantined test(s) did not run:", 2, 4).Return()
+			logger.On("Printf", "- %s", "io.bitrise.sample.QuarantinedTest.ignoredNetwork").Return()
+			logger.On("Printf", "- %s", "io.bitrise.sample.QuarantinedTest.fixedParser (app-release)").Return()
+
+			e := exporter{
+				logger:    logger,
+				converter: junitxml.Converter{},
+			}
+			err := e.ReportQuarantinedTestResults(quarantinedTests, artifacts, historyDir)
+			require.NoError(t, err)
+		})
+	}
+}
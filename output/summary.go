@@ -0,0 +1,207 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+)
+
+const (
+	testSummaryFileName      = "test-summary.md"
+	testSummaryPathEnvVarKey = "BITRISE_TEST_SUMMARY_PATH"
+
+	summaryFailureMessageLines = 3
+	summarySlowestTests        = 10
+)
+
+// testSummary counts the test cases of a module and variant (or of every module and variant).
+// Errored test cases, which failed with an error in every failed execution, are counted as failed as well.
+type testSummary struct {
+	Module  string
+	Variant string
+	Tests   int
+	Passed  int
+	Failed  int
+	Errored int
+	Flaky   int
+	Skipped int
+	Time    float64
+}
+
+func (s *testSummary) add(result *testCaseResults) {
+	s.Tests++
+	s.Time += result.Time
+
+	switch {
+	case result.isSkipped():
+		s.Skipped++
+	case result.isFailed():
+		s.Failed++
+		if result.Errored == result.Failed {
+			s.Errored++
+		}
+	default:
+		s.Passed++
+		if result.isFlaky() {
+			s.Flaky++
+		}
+	}
+}
+
+// ExportTestSummary renders a Markdown summary of the test results (totals, a per module and variant table,
+// the failed and the slowest test cases) into the deploy dir, and exports its path in the BITRISE_TEST_SUMMARY_PATH env var.
+func (e exporter) ExportTestSummary(deployDir string, artifacts []gradle.Artifact) error {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	summaryPth := filepath.Join(deployDir, testSummaryFileName)
+	if err := os.WriteFile(summaryPth, []byte(renderTestSummary(keys, results)), 0o644); err != nil {
+		return fmt.Errorf("failed to write test summary (%s): %w", summaryPth, err)
+	}
+
+	e.logger.Donef("Test summary written to %s, exporting %s env var", summaryPth, testSummaryPathEnvVarKey)
+
+	if err := e.envRepository.Set(testSummaryPathEnvVarKey, summaryPth); err != nil {
+		errs = append(errs, fmt.Errorf("failed to export %s: %w", testSummaryPathEnvVarKey, err))
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to export test summary:\n%s", errMsg)
+	}
+
+	return nil
+}
+
+func renderTestSummary(keys []testCaseKey, results map[testCaseKey]*testCaseResults) string {
+	total := testSummary{}
+	var suites []*testSummary
+	suiteIndexes := map[[2]string]int{}
+	var failed, timed []testCaseKey
+
+	for _, key := range keys {
+		result := results[key]
+		total.add(result)
+
+		suite := [2]string{key.Module, key.Variant}
+		i, ok := suiteIndexes[suite]
+		if !ok {
+			i = len(suites)
+			suiteIndexes[suite] = i
+			suites = append(suites, &testSummary{Module: key.Module, Variant: key.Variant})
+		}
+		suites[i].add(result)
+
+		if result.isFailed() {
+			failed = append(failed, key)
+		}
+		if result.Time > 0 {
+			timed = append(timed, key)
+		}
+	}
+
+	sort.Slice(suites, func(i, j int) bool {
+		if suites[i].Module != suites[j].Module {
+			return suites[i].Module < suites[j].Module
+		}
+		return suites[i].Variant < suites[j].Variant
+	})
+
+	var b strings.Builder
+	b.WriteString("## Unit test results\n\n")
+
+	status := "✅"
+	if total.Failed > 0 {
+		status = "❌"
+	}
+	fmt.Fprintf(&b, "%s **%d test(s)**: %d passed, %d failed, %d skipped", status, total.Tests, total.Passed, total.Failed, total.Skipped)
+	if total.Flaky > 0 {
+		fmt.Fprintf(&b, " (%d flaky)", total.Flaky)
+	}
+	fmt.Fprintf(&b, " in %s\n", formatTestTime(total.Time))
+
+	if len(suites) > 0 {
+		b.WriteString("\n| Module | Variant | Tests | Passed | Failed | Flaky | Skipped | Time |\n")
+		b.WriteString("| --- | --- | ---: | ---: | ---: | ---: | ---: | ---: |\n")
+		for _, suite := range suites {
+			module, variant := suite.Module, suite.Variant
+			if module == "" {
+				module, variant = testaddon.OtherDirName, "-"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %d | %d | %s |\n", markdownTableCell(module), markdownTableCell(variant),
+				suite.Tests, suite.Passed, suite.Failed, suite.Flaky, suite.Skipped, formatTestTime(suite.Time))
+		}
+	}
+
+	if len(failed) > 0 {
+		b.WriteString("\n### Failed tests\n\n")
+		for _, key := range failed {
+			fmt.Fprintf(&b, "- `%s`", testCaseName(key))
+			if key.Module != "" {
+				fmt.Fprintf(&b, " (%s-%s)", key.Module, key.Variant)
+			}
+			b.WriteString("\n")
+
+			if messages := results[key].FailureMessages; len(messages) > 0 {
+				b.WriteString("  ```\n")
+				for _, line := range firstLines(messages[0], summaryFailureMessageLines) {
+					fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(line, "```", "'''"))
+				}
+				b.WriteString("  ```\n")
+			}
+		}
+	}
+
+	if len(timed) > 0 {
+		sort.SliceStable(timed, func(i, j int) bool {
+			return results[timed[i]].Time > results[timed[j]].Time
+		})
+		if len(timed) > summarySlowestTests {
+			timed = timed[:summarySlowestTests]
+		}
+
+		b.WriteString("\n### Slowest tests\n\n")
+		b.WriteString("| Test | Module | Variant | Time |\n")
+		b.WriteString("| --- | --- | --- | ---: |\n")
+		for _, key := range timed {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownTableCell(testCaseName(key)), markdownTableCell(key.Module), markdownTableCell(key.Variant),
+				formatTestTime(results[key].Time))
+		}
+	}
+
+	return b.String()
+}
+
+func testCaseName(key testCaseKey) string {
+	if key.ClassName == "" {
+		return key.Name
+	}
+	return key.ClassName + "." + key.Name
+}
+
+func firstLines(s string, n int) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = append(lines[:n], "...")
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return lines
+}
+
+func markdownTableCell(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+}
+
+func formatTestTime(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
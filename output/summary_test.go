@@ -0,0 +1,45 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportTestSummary(t *testing.T) {
+	artifacts := testResultArtifacts("summary",
+		"app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml",
+		"lib/build/test-results/testReleaseUnitTest/TEST-io.bitrise.sample.FormatterTest.xml",
+	)
+
+	deployDir := t.TempDir()
+	summaryPth := filepath.Join(deployDir, testSummaryFileName)
+
+	logger := mocks.NewLogger(t)
+	logger.On("Donef", mock.Anything, summaryPth, testSummaryPathEnvVarKey).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", testSummaryPathEnvVarKey, summaryPth).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportTestSummary(deployDir, artifacts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(summaryPth)
+	require.NoError(t, err)
+	want, err := os.ReadFile(filepath.Join("testdata", "test-summary.md"))
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(content))
+}
+
+func Test_renderTestSummary_noTests(t *testing.T) {
+	require.Equal(t, "## Unit test results\n\n✅ **0 test(s)**: 0 passed, 0 failed, 0 skipped in 0s\n", renderTestSummary(nil, nil))
+}
@@ -0,0 +1,77 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+)
+
+const (
+	testTotalCountEnvVarKey           = "BITRISE_TEST_TOTAL_COUNT"
+	testPassedCountEnvVarKey          = "BITRISE_TEST_PASSED_COUNT"
+	testFailedCountEnvVarKey          = "BITRISE_TEST_FAILED_COUNT"
+	testErroredCountEnvVarKey         = "BITRISE_TEST_ERRORED_COUNT"
+	testSkippedCountEnvVarKey         = "BITRISE_TEST_SKIPPED_COUNT"
+	testQuarantineEntryCountEnvVarKey = "BITRISE_TEST_QUARANTINE_ENTRY_COUNT"
+	testTimeEnvVarKey                 = "BITRISE_TEST_TIME"
+	testWallTimeEnvVarKey             = "BITRISE_TEST_WALL_TIME"
+)
+
+// ExportTestCounts exports the number of total, passed, failed, errored and skipped test cases of the test results,
+// the number of quarantine entries applying to the executed test suites, the sum of the test case durations
+// and the wall time of the test run (in seconds). Every env var is set, even if the test results are missing.
+//
+// Quarantined tests are excluded from the test run, so they are not part of the test results: the number of the entries
+// is exported, not the number of the test cases they exclude (an entry can exclude a whole class or match no test).
+func (e exporter) ExportTestCounts(artifacts []gradle.Artifact, quarantinedTests []gradleconfig.TestPattern, testSuiteNames []string, wallTime time.Duration) error {
+	keys, results, errs := e.collectTestCaseResults(artifacts)
+
+	total := testSummary{}
+	for _, key := range keys {
+		total.add(results[key])
+	}
+
+	quarantineEntries := 0
+	for _, pattern := range quarantinedTests {
+		if slices.ContainsFunc(testSuiteNames, func(testSuiteName string) bool {
+			return gradleconfig.AppliesToTestSuite(pattern, testSuiteName)
+		}) {
+			quarantineEntries++
+		}
+	}
+
+	envs := []struct {
+		key   string
+		value string
+	}{
+		{testTotalCountEnvVarKey, strconv.Itoa(total.Tests)},
+		{testPassedCountEnvVarKey, strconv.Itoa(total.Passed)},
+		{testFailedCountEnvVarKey, strconv.Itoa(total.Failed - total.Errored)},
+		{testErroredCountEnvVarKey, strconv.Itoa(total.Errored)},
+		{testSkippedCountEnvVarKey, strconv.Itoa(total.Skipped)},
+		{testQuarantineEntryCountEnvVarKey, strconv.Itoa(quarantineEntries)},
+		{testTimeEnvVarKey, strconv.FormatFloat(total.Time, 'f', 3, 64)},
+		{testWallTimeEnvVarKey, strconv.FormatFloat(wallTime.Seconds(), 'f', 3, 64)},
+	}
+
+	for _, env := range envs {
+		e.logger.Printf("%s: %s", env.key, env.value)
+		if err := e.envRepository.Set(env.key, env.value); err != nil {
+			errs = append(errs, fmt.Errorf("failed to export %s: %w", env.key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		errMsg := ""
+		for _, err := range errs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to export test counts:\n%s", errMsg)
+	}
+
+	return nil
+}
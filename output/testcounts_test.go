@@ -0,0 +1,66 @@
+package output
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ExportTestCounts(t *testing.T) {
+	artifacts := testResultArtifacts("test-counts", "app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml")
+
+	quarantinedTests := []gradleconfig.TestPattern{
+		{Pattern: "io.bitrise.sample.FormatterTest", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "io.bitrise.sample.FormatterTest", TestSuiteNames: []string{"app-release"}},
+		{Pattern: "io.bitrise.sample.ParserTest.parsesBinary"},
+		{Pattern: "io.bitrise.sample.LoginTest", TestSuiteNames: []string{"lib-debug", "login-debug"}},
+	}
+
+	logger := mocks.NewLogger(t)
+	logger.On("Printf", mock.Anything, mock.Anything, mock.Anything).Return()
+	envRepository := mocks.NewRepository(t)
+	for key, value := range map[string]string{
+		testTotalCountEnvVarKey:           "5",
+		testPassedCountEnvVarKey:          "2",
+		testFailedCountEnvVarKey:          "1",
+		testErroredCountEnvVarKey:         "1",
+		testSkippedCountEnvVarKey:         "1",
+		testQuarantineEntryCountEnvVarKey: "3",
+		testTimeEnvVarKey:                 "1.500",
+		testWallTimeEnvVarKey:             "75.120",
+	} {
+		envRepository.On("Set", key, value).Return(nil)
+	}
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportTestCounts(artifacts, quarantinedTests, []string{"app-debug", "login-debug"}, 75120*time.Millisecond)
+	require.NoError(t, err)
+}
+
+func Test_exporter_ExportTestCounts_noResults(t *testing.T) {
+	logger := mocks.NewLogger(t)
+	logger.On("Printf", mock.Anything, mock.Anything, mock.Anything).Return()
+	envRepository := mocks.NewRepository(t)
+	envRepository.On("Set", mock.Anything, mock.Anything).Return(nil)
+
+	e := exporter{
+		envRepository: envRepository,
+		logger:        logger,
+		converter:     junitxml.Converter{},
+	}
+	err := e.ExportTestCounts(nil, nil, nil, 3*time.Second)
+	require.NoError(t, err)
+
+	envRepository.AssertNumberOfCalls(t, "Set", 8)
+	envRepository.AssertCalled(t, "Set", testTotalCountEnvVarKey, "0")
+	envRepository.AssertCalled(t, "Set", testWallTimeEnvVarKey, "3.000")
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"fmt"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+)
+
+func (e exporter) ReportUnmatchedTestFilters(patterns []gradleconfig.TestPattern, artifacts []gradle.Artifact) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	matched := map[string]bool{}
+	var convertErrs []error
+
+	for _, artifact := range artifacts {
+		testReport, err := e.convertTestReport(artifact.Path)
+		if err != nil {
+			convertErrs = append(convertErrs, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err))
+			continue
+		}
+
+		for _, suite := range testReport.TestSuites {
+			markMatchedTestPatterns(suite, patterns, matched)
+		}
+	}
+
+	var unmatched []string
+	for _, pattern := range patterns {
+		if !matched[pattern.Pattern] {
+			unmatched = append(unmatched, pattern.Pattern)
+		}
+	}
+
+	if len(unmatched) == 0 {
+		e.logger.Donef("Every test filter pattern matched at least one test case")
+	} else {
+		e.logger.Warnf("%d/%d test filter pattern(s) matched no test case:", len(unmatched), len(patterns))
+		for _, pattern := range unmatched {
+			e.logger.Warnf("- %s", pattern)
+		}
+	}
+
+	if len(convertErrs) > 0 {
+		errMsg := ""
+		for _, err := range convertErrs {
+			errMsg += fmt.Sprintf("- %s\n", err.Error())
+		}
+		return fmt.Errorf("failed to check %d/%d test artifacts:\n%s", len(convertErrs), len(artifacts), errMsg)
+	}
+
+	return nil
+}
+
+func markMatchedTestPatterns(suite testreport.TestSuite, patterns []gradleconfig.TestPattern, matched map[string]bool) {
+	for _, testCase := range suite.TestCases {
+		for _, pattern := range patterns {
+			if !matched[pattern.Pattern] && gradleconfig.MatchesTestPattern(pattern.Pattern, testCase.ClassName, testCase.Name) {
+				matched[pattern.Pattern] = true
+			}
+		}
+	}
+
+	for _, childSuite := range suite.TestSuites {
+		markMatchedTestPatterns(childSuite, patterns, matched)
+	}
+}
@@ -0,0 +1,54 @@
+package output
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_exporter_ReportUnmatchedTestFilters(t *testing.T) {
+	_, b, _, _ := runtime.Caller(0)
+	testResultXML := filepath.Join(filepath.Dir(b), "testdata", "TEST-io.bitrise.kotlinresponsiveviewsactivity.UniTest.xml")
+
+	tests := []struct {
+		name     string
+		patterns []gradleconfig.TestPattern
+		mockLogs func(logger *mocks.Logger)
+	}{
+		{
+			name:     "Every pattern matched",
+			patterns: []gradleconfig.TestPattern{{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.*"}, {Pattern: "UniTest.successful"}},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Donef", "Every test filter pattern matched at least one test case").Return()
+			},
+		},
+		{
+			name:     "Unmatched patterns are reported",
+			patterns: []gradleconfig.TestPattern{{Pattern: "io.bitrise.kotlinresponsiveviewsactivity.*"}, {Pattern: "com.acme.payments.*"}, {Pattern: "UniTest.missing"}},
+			mockLogs: func(logger *mocks.Logger) {
+				logger.On("Warnf", "%d/%d test filter pattern(s) matched no test case:", 2, 3).Return()
+				logger.On("Warnf", "- %s", "com.acme.payments.*").Return()
+				logger.On("Warnf", "- %s", "UniTest.missing").Return()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := mocks.NewLogger(t)
+			tt.mockLogs(logger)
+
+			e := exporter{
+				logger:    logger,
+				converter: junitxml.Converter{},
+			}
+			err := e.ReportUnmatchedTestFilters(tt.patterns, []gradle.Artifact{{Path: testResultXML}})
+			require.NoError(t, err)
+		})
+	}
+}
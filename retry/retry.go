@@ -0,0 +1,268 @@
+package retry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/testaddon"
+)
+
+// FailedTests collects the failed (or errored) test cases of the JUnit XML results as Gradle test filter patterns.
+// Patterns are scoped to the test suite (<module>-<variant>) the result belongs to, so that a retry only reruns
+// the failed test cases in the unit test task they failed in.
+func FailedTests(artifacts []gradle.Artifact) ([]gradleconfig.TestPattern, error) {
+	testSuiteNamesByPattern := map[string][]string{}
+	unscoped := map[string]bool{}
+
+	for _, artifact := range artifacts {
+		converter := junitxml.Converter{}
+		if !converter.Detect([]string{artifact.Path}) {
+			continue
+		}
+
+		testReport, err := converter.Convert()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err)
+		}
+
+		var failedTestCases []testreport.TestCase
+		for _, suite := range testReport.TestSuites {
+			failedTestCases = append(failedTestCases, collectFailedTestCases(suite)...)
+		}
+
+		testSuiteName := testaddon.TestSuiteName(artifact.Path)
+		for _, testCase := range failedTestCases {
+			pattern := gradleconfig.TestFilterPattern(testCase.ClassName, testCase.Name)
+			if testSuiteName == "" {
+				unscoped[pattern] = true
+			} else if !slices.Contains(testSuiteNamesByPattern[pattern], testSuiteName) {
+				testSuiteNamesByPattern[pattern] = append(testSuiteNamesByPattern[pattern], testSuiteName)
+			}
+		}
+	}
+
+	var patterns []gradleconfig.TestPattern
+	for pattern := range unscoped {
+		patterns = append(patterns, gradleconfig.TestPattern{Pattern: pattern})
+	}
+	for pattern, testSuiteNames := range testSuiteNamesByPattern {
+		if unscoped[pattern] {
+			continue
+		}
+		sort.Strings(testSuiteNames)
+		patterns = append(patterns, gradleconfig.TestPattern{Pattern: pattern, TestSuiteNames: testSuiteNames})
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		return patterns[i].Pattern < patterns[j].Pattern
+	})
+
+	return patterns, nil
+}
+
+// NotRunTests returns the failed test patterns, which match no executed (not skipped) test case of the JUnit XML results
+// in each of the test suites they are scoped to. A failure, which can not be addressed by a test filter pattern
+// (for example a JUnit 4 initializationError or a JUnit 5 classMethod failure), does not run in the retry.
+func NotRunTests(failedTests []gradleconfig.TestPattern, artifacts []gradle.Artifact) ([]gradleconfig.TestPattern, error) {
+	// executed maps the index of the failed test to the test suites it ran in, results outside of
+	// the <module>/build/test-results/test<Variant>UnitTest layout are recorded with an empty test suite name.
+	executed := make([]map[string]bool, len(failedTests))
+	for i := range executed {
+		executed[i] = map[string]bool{}
+	}
+
+	for _, artifact := range artifacts {
+		converter := junitxml.Converter{}
+		if !converter.Detect([]string{artifact.Path}) {
+			continue
+		}
+
+		testReport, err := converter.Convert()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert test report (%s): %w", artifact.Path, err)
+		}
+
+		testSuiteName := testaddon.TestSuiteName(artifact.Path)
+		for _, suite := range testReport.TestSuites {
+			markExecutedTests(suite, testSuiteName, failedTests, executed)
+		}
+	}
+
+	var notRun []gradleconfig.TestPattern
+	for i, failedTest := range failedTests {
+		ran := len(executed[i]) > 0
+		if ran && !executed[i][""] {
+			for _, testSuiteName := range failedTest.TestSuiteNames {
+				ran = ran && executed[i][testSuiteName]
+			}
+		}
+		if !ran {
+			notRun = append(notRun, failedTest)
+		}
+	}
+
+	return notRun, nil
+}
+
+func markExecutedTests(suite testreport.TestSuite, testSuiteName string, patterns []gradleconfig.TestPattern, executed []map[string]bool) {
+	for _, testCase := range suite.TestCases {
+		if testCase.Skipped != nil {
+			continue
+		}
+
+		for i, pattern := range patterns {
+			if testSuiteName != "" && !gradleconfig.AppliesToTestSuite(pattern, testSuiteName) {
+				continue
+			}
+			if gradleconfig.MatchesTestPattern(pattern.Pattern, testCase.ClassName, testCase.Name) {
+				executed[i][testSuiteName] = true
+			}
+		}
+	}
+
+	for _, childSuite := range suite.TestSuites {
+		markExecutedTests(childSuite, testSuiteName, patterns, executed)
+	}
+}
+
+func collectFailedTestCases(suite testreport.TestSuite) []testreport.TestCase {
+	var testCases []testreport.TestCase
+	for _, testCase := range suite.TestCases {
+		if (testCase.Failure != nil || testCase.Error != nil) && testCase.ClassName != "" {
+			testCases = append(testCases, testCase)
+		}
+	}
+
+	for _, childSuite := range suite.TestSuites {
+		testCases = append(testCases, collectFailedTestCases(childSuite)...)
+	}
+
+	return testCases
+}
+
+var attemptResultPathRegexp = regexp.MustCompile(`^(.*)-attempt(\d+)(\.[^./\\]*)$`)
+
+// Attempts keeps the JUnit XML results of the previous test run attempts,
+// as Gradle deletes the results of a Test task when it runs again.
+type Attempts struct {
+	dir     string
+	results []stashedResult
+}
+
+type stashedResult struct {
+	attempt      int
+	originalPath string
+	stashedPath  string
+}
+
+// NewAttempts creates an Attempts, which stashes the results into the given directory.
+func NewAttempts(dir string) *Attempts {
+	return &Attempts{dir: dir}
+}
+
+// Stash copies the results of the given (1-based) attempt into the stash directory.
+func (a *Attempts) Stash(attempt int, artifacts []gradle.Artifact) error {
+	for i, artifact := range artifacts {
+		stashedPath := filepath.Join(a.dir, fmt.Sprintf("attempt%d", attempt), fmt.Sprintf("%d-%s", i, filepath.Base(artifact.Path)))
+		if err := copyFile(artifact.Path, stashedPath); err != nil {
+			return fmt.Errorf("failed to stash test result (%s): %w", artifact.Path, err)
+		}
+
+		a.results = append(a.results, stashedResult{attempt: attempt, originalPath: artifact.Path, stashedPath: stashedPath})
+	}
+	return nil
+}
+
+// Restore copies the stashed results back next to their original location, with an attempt suffix in their name:
+// TEST-com.acme.ParserTest.xml of the first attempt is restored as TEST-com.acme.ParserTest-attempt1.xml.
+// The results of the last attempt are left in place, under their original name, and the stashed results
+// which are still in place (as their Test task did not run again) are not duplicated.
+func (a *Attempts) Restore() ([]string, error) {
+	var restored []string
+	for _, result := range a.results {
+		if unchanged, err := sameContent(result.stashedPath, result.originalPath); err != nil {
+			return restored, err
+		} else if unchanged {
+			continue
+		}
+
+		pth := AttemptResultPath(result.originalPath, result.attempt)
+		if err := copyFile(result.stashedPath, pth); err != nil {
+			return restored, fmt.Errorf("failed to restore test result (%s): %w", pth, err)
+		}
+		restored = append(restored, pth)
+	}
+	return restored, nil
+}
+
+// AttemptResultPath returns the path of the given attempt's copy of a test result.
+func AttemptResultPath(pth string, attempt int) string {
+	ext := filepath.Ext(pth)
+	return fmt.Sprintf("%s-attempt%d%s", strings.TrimSuffix(pth, ext), attempt, ext)
+}
+
+// ParseAttemptResultPath returns the original path of a test result restored by Restore and its attempt:
+// TEST-com.acme.ParserTest-attempt1.xml is the first attempt of TEST-com.acme.ParserTest.xml.
+// ok is false for a result without an attempt suffix, which is the result of the last attempt.
+func ParseAttemptResultPath(pth string) (originalPath string, attempt int, ok bool) {
+	match := attemptResultPathRegexp.FindStringSubmatch(pth)
+	if match == nil {
+		return pth, 0, false
+	}
+	attempt, err := strconv.Atoi(match[2])
+	if err != nil {
+		return pth, 0, false
+	}
+	return match[1] + match[3], attempt, true
+}
+
+func sameContent(stashedPath, pth string) (bool, error) {
+	current, err := os.ReadFile(pth)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	stashed, err := os.ReadFile(stashedPath)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(current, stashed), nil
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		_ = dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
@@ -0,0 +1,88 @@
+package retry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailedTests(t *testing.T) {
+	got, err := FailedTests([]gradle.Artifact{
+		{Path: "testdata/app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml"},
+		{Path: "testdata/lib/build/test-results/testReleaseUnitTest/TEST-io.bitrise.sample.ParserTest.xml"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []gradleconfig.TestPattern{
+		{Pattern: "io.bitrise.sample.ParserTest$Nested.parsesNestedValue", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "io.bitrise.sample.ParserTest.parsesDecimal", TestSuiteNames: []string{"app-debug", "lib-release"}},
+	}, got)
+}
+
+func TestNotRunTests(t *testing.T) {
+	got, err := NotRunTests([]gradleconfig.TestPattern{
+		{Pattern: "io.bitrise.sample.ParserTest$Nested.parsesNestedValue", TestSuiteNames: []string{"app-debug"}},
+		// Reported by JUnit 4 if the test class can not be initialized, the test filter matches no test method.
+		{Pattern: "io.bitrise.sample.ParserTest.initializationError", TestSuiteNames: []string{"app-debug"}},
+		// Retried in the app module only.
+		{Pattern: "io.bitrise.sample.ParserTest.parsesDecimal", TestSuiteNames: []string{"app-debug", "lib-release"}},
+		{Pattern: "io.bitrise.sample.ParserTest.rejectsBlankInput"},
+	}, []gradle.Artifact{
+		{Path: "testdata/app/build/test-results/testDebugUnitTest/TEST-io.bitrise.sample.ParserTest.xml"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []gradleconfig.TestPattern{
+		{Pattern: "io.bitrise.sample.ParserTest.initializationError", TestSuiteNames: []string{"app-debug"}},
+		{Pattern: "io.bitrise.sample.ParserTest.parsesDecimal", TestSuiteNames: []string{"app-debug", "lib-release"}},
+	}, got)
+}
+
+func TestAttempts(t *testing.T) {
+	resultsDir := filepath.Join(t.TempDir(), "app", "build", "test-results", "testDebugUnitTest")
+	require.NoError(t, os.MkdirAll(resultsDir, 0o755))
+	parserTest := filepath.Join(resultsDir, "TEST-io.bitrise.sample.ParserTest.xml")
+	formatterTest := filepath.Join(resultsDir, "TEST-io.bitrise.sample.FormatterTest.xml")
+
+	require.NoError(t, os.WriteFile(parserTest, []byte("attempt 1"), 0o644))
+	require.NoError(t, os.WriteFile(formatterTest, []byte("attempt 1"), 0o644))
+
+	attempts := NewAttempts(t.TempDir())
+	require.NoError(t, attempts.Stash(1, []gradle.Artifact{{Path: parserTest}, {Path: formatterTest}}))
+
+	// The retry only reruns ParserTest, Gradle deletes the other results of the task.
+	require.NoError(t, os.Remove(formatterTest))
+	require.NoError(t, os.WriteFile(parserTest, []byte("attempt 2"), 0o644))
+	require.NoError(t, attempts.Stash(2, []gradle.Artifact{{Path: parserTest}}))
+
+	// The last retry does not rerun ParserTest.
+	restored, err := attempts.Restore()
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(resultsDir, "TEST-io.bitrise.sample.ParserTest-attempt1.xml"),
+		filepath.Join(resultsDir, "TEST-io.bitrise.sample.FormatterTest-attempt1.xml"),
+	}, restored)
+
+	content, err := os.ReadFile(filepath.Join(resultsDir, "TEST-io.bitrise.sample.ParserTest-attempt1.xml"))
+	require.NoError(t, err)
+	require.Equal(t, "attempt 1", string(content))
+
+	content, err = os.ReadFile(parserTest)
+	require.NoError(t, err)
+	require.Equal(t, "attempt 2", string(content))
+}
+
+func TestParseAttemptResultPath(t *testing.T) {
+	pth := filepath.Join("app", "build", "test-results", "testDebugUnitTest", "TEST-io.bitrise.sample.ParserTest.xml")
+
+	originalPath, attempt, ok := ParseAttemptResultPath(AttemptResultPath(pth, 12))
+	require.True(t, ok)
+	require.Equal(t, pth, originalPath)
+	require.Equal(t, 12, attempt)
+
+	originalPath, _, ok = ParseAttemptResultPath(pth)
+	require.False(t, ok)
+	require.Equal(t, pth, originalPath)
+}
@@ -0,0 +1,88 @@
+package sharding
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+var (
+	packageRegexp = regexp.MustCompile(`^\s*package\s+([\w.]+)`)
+	// Top level classes are declared at the start of the line, nested classes are indented.
+	classRegexp = regexp.MustCompile(`^(?:(?:public|internal|private|protected|abstract|open|final|sealed|data|strictfp)\s+)*class\s+([A-Za-z_$][\w$]*)`)
+)
+
+// DiscoverTestClasses lists the fully qualified names of the top level classes declared in the local unit test source sets
+// (src/test, src/test<Variant>) of the given module directories. Test fixtures (src/testFixtures) are not test classes.
+//
+// Class names are read from the package and class declarations of the Java and Kotlin sources,
+// as a Kotlin file can declare several classes, named differently than the file.
+func DiscoverTestClasses(moduleDirs []string) ([]string, error) {
+	classes := map[string]bool{}
+
+	for _, moduleDir := range moduleDirs {
+		sourceSetDirs, err := filepath.Glob(filepath.Join(moduleDir, "src", "test*"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sourceSetDir := range sourceSetDirs {
+			if filepath.Base(sourceSetDir) == "testFixtures" {
+				continue
+			}
+
+			err := filepath.Walk(sourceSetDir, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				ext := filepath.Ext(path)
+				if info.IsDir() || (ext != ".java" && ext != ".kt") {
+					return nil
+				}
+
+				return readClassNames(path, classes)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var classNames []string
+	for className := range classes {
+		classNames = append(classNames, className)
+	}
+	sort.Strings(classNames)
+
+	return classNames, nil
+}
+
+func readClassNames(pth string, classes map[string]bool) error {
+	f, err := os.Open(pth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	packageName := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := packageRegexp.FindStringSubmatch(line); match != nil && packageName == "" {
+			packageName = match[1]
+		} else if match := classRegexp.FindStringSubmatch(line); match != nil {
+			if packageName != "" {
+				classes[packageName+"."+match[1]] = true
+			} else {
+				classes[match[1]] = true
+			}
+		}
+	}
+
+	return scanner.Err()
+}
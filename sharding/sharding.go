@@ -0,0 +1,103 @@
+package sharding
+
+import (
+	"sort"
+)
+
+// Shard is a set of test classes executed by a single parallel worker.
+type Shard struct {
+	Index    int
+	Classes  []string
+	Duration float64
+}
+
+// Plan distributes the given test classes among count shards.
+//
+// Classes are balanced by their previously measured durations (in seconds), using the longest processing time first
+// heuristic. Classes without timing data are weighted with the average of the known durations.
+// If no timing data is available at all, every class has the same weight, so the classes are balanced by count.
+// The result only depends on the inputs, so every worker computes the same plan.
+func Plan(classes []string, timings map[string]float64, count int) []Shard {
+	if count < 1 {
+		count = 1
+	}
+
+	weights := classWeights(classes, timings)
+
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if weights[names[i]] != weights[names[j]] {
+			return weights[names[i]] > weights[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	shards := make([]Shard, count)
+	for i := range shards {
+		shards[i].Index = i
+	}
+
+	for _, name := range names {
+		lightest := 0
+		for i := 1; i < count; i++ {
+			if shards[i].Duration < shards[lightest].Duration ||
+				(shards[i].Duration == shards[lightest].Duration && len(shards[i].Classes) < len(shards[lightest].Classes)) {
+				lightest = i
+			}
+		}
+
+		shards[lightest].Classes = append(shards[lightest].Classes, name)
+		shards[lightest].Duration += weights[name]
+	}
+
+	for i := range shards {
+		sort.Strings(shards[i].Classes)
+	}
+
+	return shards
+}
+
+// Assignments returns the shard index of every planned test class.
+func Assignments(shards []Shard) map[string]int {
+	assignments := map[string]int{}
+	for _, shard := range shards {
+		for _, class := range shard.Classes {
+			assignments[class] = shard.Index
+		}
+	}
+	return assignments
+}
+
+// classWeights weights the classes with their durations, timings of classes which no longer exist are ignored,
+// so that they skew neither the plan nor the average duration of the classes without timing data.
+func classWeights(classes []string, timings map[string]float64) map[string]float64 {
+	weights := map[string]float64{}
+
+	total, timed := 0.0, 0
+	for _, class := range classes {
+		if duration, ok := timings[class]; ok {
+			weights[class] = duration
+			total += duration
+			timed++
+		}
+	}
+
+	if timed == 0 {
+		for _, class := range classes {
+			weights[class] = 1
+		}
+		return weights
+	}
+
+	average := total / float64(timed)
+	for _, class := range classes {
+		if _, ok := weights[class]; !ok {
+			weights[class] = average
+		}
+	}
+
+	return weights
+}
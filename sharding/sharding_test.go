@@ -0,0 +1,144 @@
+package sharding
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		classes []string
+		timings map[string]float64
+		count   int
+		want    []Shard
+	}{
+		{
+			name:    "Balances by class count without timing data",
+			classes: []string{"d.Test", "b.Test", "a.Test", "c.Test", "e.Test"},
+			count:   2,
+			want: []Shard{
+				{Index: 0, Classes: []string{"a.Test", "c.Test", "e.Test"}, Duration: 3},
+				{Index: 1, Classes: []string{"b.Test", "d.Test"}, Duration: 2},
+			},
+		},
+		{
+			name:    "Balances by duration",
+			classes: []string{"a.Test", "b.Test", "c.Test", "d.Test"},
+			timings: map[string]float64{"a.Test": 10, "b.Test": 6, "c.Test": 4, "d.Test": 1},
+			count:   2,
+			want: []Shard{
+				{Index: 0, Classes: []string{"a.Test", "d.Test"}, Duration: 11},
+				{Index: 1, Classes: []string{"b.Test", "c.Test"}, Duration: 10},
+			},
+		},
+		{
+			name:    "Classes without timing data are weighted with the average duration",
+			classes: []string{"a.Test", "b.Test", "new.Test"},
+			timings: map[string]float64{"a.Test": 4, "b.Test": 2},
+			count:   2,
+			want: []Shard{
+				{Index: 0, Classes: []string{"a.Test"}, Duration: 4},
+				{Index: 1, Classes: []string{"b.Test", "new.Test"}, Duration: 5},
+			},
+		},
+		{
+			name:    "Timings of removed classes are ignored",
+			classes: []string{"a.Test", "b.Test", "new.Test"},
+			timings: map[string]float64{"a.Test": 4, "b.Test": 2, "removed.Test": 30},
+			count:   2,
+			want: []Shard{
+				{Index: 0, Classes: []string{"a.Test"}, Duration: 4},
+				{Index: 1, Classes: []string{"b.Test", "new.Test"}, Duration: 5},
+			},
+		},
+		{
+			name:    "Balances by class count if no class has timing data",
+			classes: []string{"a.Test", "b.Test", "c.Test"},
+			timings: map[string]float64{"removed.Test": 30},
+			count:   2,
+			want: []Shard{
+				{Index: 0, Classes: []string{"a.Test", "c.Test"}, Duration: 2},
+				{Index: 1, Classes: []string{"b.Test"}, Duration: 1},
+			},
+		},
+		{
+			name:    "Zero durations are still balanced by count",
+			classes: []string{"a.Test", "b.Test"},
+			timings: map[string]float64{"a.Test": 0, "b.Test": 0},
+			count:   2,
+			want: []Shard{
+				{Index: 0, Classes: []string{"a.Test"}},
+				{Index: 1, Classes: []string{"b.Test"}},
+			},
+		},
+		{
+			name:  "More shards than classes",
+			count: 2,
+			want: []Shard{
+				{Index: 0},
+				{Index: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Plan(tt.classes, tt.timings, tt.count)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	shards := []Shard{
+		{Index: 0, Classes: []string{"a.Test", "c.Test"}},
+		{Index: 1, Classes: []string{"b.Test"}},
+	}
+	require.Equal(t, map[string]int{"a.Test": 0, "b.Test": 1, "c.Test": 0}, Assignments(shards))
+}
+
+func TestLoadTimings(t *testing.T) {
+	_, b, _, _ := runtime.Caller(0)
+	testDataDir := filepath.Join(filepath.Dir(b), "testdata")
+
+	got, err := LoadTimings(testDataDir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{
+		"io.bitrise.sample.ParserTest":    1.5,
+		"io.bitrise.sample.FormatterTest": 0.125,
+	}, got)
+}
+
+func TestDiscoverTestClasses(t *testing.T) {
+	projectDir := t.TempDir()
+	files := map[string]string{
+		"app/src/test/java/io/bitrise/sample/ParserTest.java":          "package io.bitrise.sample;\n\npublic class ParserTest {\n    static class Nested {}\n}\n",
+		"app/src/testDebug/kotlin/io/bitrise/sample/DebugTest.kt":      "// Copyright\npackage io.bitrise.sample\n\nclass DebugTest\n",
+		"app/src/test/kotlin/io/bitrise/sample/FormatterTests.kt":      "package io.bitrise.sample\n\nclass FormatterTest {\n    inner class Nested\n}\n\ninternal class DateFormatterTest\n\nfun helper() = Unit\n",
+		"app/src/main/java/io/bitrise/sample/Parser.java":              "package io.bitrise.sample;\n\nclass Parser {}\n",
+		"app/src/androidTest/java/io/bitrise/sample/ParserUiTest.java": "package io.bitrise.sample;\n\nclass ParserUiTest {}\n",
+		"app/src/testFixtures/kotlin/io/bitrise/sample/Fixtures.kt":    "package io.bitrise.sample\n\nclass Fixtures\n",
+		"app/build/generated/src/test/java/io/bitrise/Generated.java":  "package io.bitrise;\n\nclass Generated {}\n",
+		"lib/src/test/kotlin/DefaultPackageTest.kt":                    "class DefaultPackageTest\n",
+		"scripts/src/test/kotlin/io/bitrise/scripts/NotAModuleTest.kt": "package io.bitrise.scripts\n\nclass NotAModuleTest\n",
+	}
+	for pth, content := range files {
+		pth = filepath.Join(projectDir, pth)
+		require.NoError(t, os.MkdirAll(filepath.Dir(pth), 0o755))
+		require.NoError(t, os.WriteFile(pth, []byte(content), 0o644))
+	}
+
+	got, err := DiscoverTestClasses([]string{filepath.Join(projectDir, "app"), filepath.Join(projectDir, "lib")})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"DefaultPackageTest",
+		"io.bitrise.sample.DateFormatterTest",
+		"io.bitrise.sample.DebugTest",
+		"io.bitrise.sample.FormatterTest",
+		"io.bitrise.sample.ParserTest",
+	}, got)
+}
@@ -0,0 +1,69 @@
+package sharding
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/testresult/junitxml"
+	"github.com/bitrise-io/go-steputils/v2/testreport"
+)
+
+// LoadTimings sums up the test class durations (in seconds) from the JUnit XML results found in the given directory.
+//
+// The directory is expected to hold the results of a previous build, for example in the layout the step exports
+// them for the test addon: <dir>/<module>-<variant>/TEST-<class>.xml.
+func LoadTimings(dir string) (map[string]float64, error) {
+	var resultXMLs []string
+	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".xml") {
+			resultXMLs = append(resultXMLs, path)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to search for test results in %s: %w", dir, err)
+	}
+
+	timings := map[string]float64{}
+	for _, resultXML := range resultXMLs {
+		converter := junitxml.Converter{}
+		if !converter.Detect([]string{resultXML}) {
+			continue
+		}
+
+		testReport, err := converter.Convert()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert test report (%s): %w", resultXML, err)
+		}
+
+		for _, suite := range testReport.TestSuites {
+			addSuiteTimings(suite, timings)
+		}
+	}
+
+	return timings, nil
+}
+
+func addSuiteTimings(suite testreport.TestSuite, timings map[string]float64) {
+	for _, testCase := range suite.TestCases {
+		if testCase.ClassName == "" {
+			continue
+		}
+		timings[topLevelClassName(testCase.ClassName)] += testCase.Time
+	}
+
+	for _, childSuite := range suite.TestSuites {
+		addSuiteTimings(childSuite, timings)
+	}
+}
+
+// topLevelClassName strips the nested class part of a class name (Outer$Inner),
+// as Gradle's test class scanning is sharded by top level classes.
+func topLevelClassName(className string) string {
+	topLevel, _, _ := strings.Cut(className, "$")
+	return topLevel
+}
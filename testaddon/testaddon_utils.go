@@ -10,15 +10,45 @@ import (
 // OtherDirName is a directory name of non Android Unit test results
 const OtherDirName = "other"
 
+// QuarantinedTestResultsDirName is the name of the directory, which holds the XML results of the quarantined test run
+// in place of the test-results directory: <module>/build/quarantined-test-results/test<Variant>UnitTest.
+const QuarantinedTestResultsDirName = "quarantined-test-results"
+
+// quarantinedExportDirSuffix marks the export dir of quarantined test results, for example app-debug-quarantined.
+const quarantinedExportDirSuffix = "-quarantined"
+
 func getExportDir(artifactPath string) string {
-	modules, variant, err := getModuleAndVariant(artifactPath)
+	modules, variant, err := ModuleAndVariant(artifactPath)
 	if err != nil {
 		return OtherDirName
 	}
 
+	if isQuarantinedTestResult(artifactPath) {
+		return modules + "-" + variant + quarantinedExportDirSuffix
+	}
+
 	return modules + "-" + variant
 }
 
+// TestSuiteName returns the <module>-<variant> name of the local unit test task, which produced the given JUnit XML result,
+// or an empty string if the result path does not follow the <module>/build/test-results/test<Variant>UnitTest layout.
+func TestSuiteName(artifactPath string) string {
+	module, variant, err := ModuleAndVariant(artifactPath)
+	if err != nil {
+		return ""
+	}
+	return module + "-" + variant
+}
+
+func isQuarantinedTestResult(artifactPath string) bool {
+	for _, part := range strings.Split(artifactPath, "/") {
+		if part == QuarantinedTestResultsDirName {
+			return true
+		}
+	}
+	return false
+}
+
 func lowercaseFirstLetter(str string) string {
 	for i, v := range str {
 		return string(unicode.ToLower(v)) + str[i+1:]
@@ -54,8 +84,9 @@ func parseModuleName(pthParts []string, testResultsPartIdx int) (string, error)
 	return pthParts[testResultsPartIdx-2], nil
 }
 
-// getVariantDir parses model and variant from the given artifact path.
-func getModuleAndVariant(path string) (string, string, error) {
+// ModuleAndVariant parses the module (directory) name and the lower camel case variant name from the given artifact path:
+// app and freeDebug for app/build/test-results/testFreeDebugUnitTest/TEST-x.xml.
+func ModuleAndVariant(path string) (string, string, error) {
 	parts := strings.Split(path, "/")
 
 	i := indexOfTestResultsDirName(parts)
@@ -80,7 +111,7 @@ func getModuleAndVariant(path string) (string, string, error) {
 func indexOfTestResultsDirName(pthParts []string) int {
 	// example: ./app/build/test-results/testDebugUnitTest/TEST-sample.results.test.multiple.bitrise.com.multipletestresultssample.UnitTest0.xml
 	for i, part := range pthParts {
-		if part == "test-results" {
+		if part == "test-results" || part == QuarantinedTestResultsDirName {
 			return i
 		}
 	}
@@ -45,7 +45,7 @@ func TestGetVariantDir(t *testing.T) {
 	}
 
 	for _, tt := range tc {
-		gotModule, gotVariant, err := getModuleAndVariant(tt.path)
+		gotModule, gotVariant, err := ModuleAndVariant(tt.path)
 		if tt.isErr {
 			require.Error(t, err)
 		} else {
@@ -72,6 +72,11 @@ func TestGetExportDir(t *testing.T) {
 			artifactPath: "./app/build/test-results/testDemoDebugUnitTest/TEST-sample.results.test.multiple.bitrise.com.multipletestresultssample.UnitTest0.xml",
 			want:         "app-demoDebug",
 		},
+		{
+			title:        "should return string in <module>-<variant>-quarantined for quarantined result path",
+			artifactPath: "./app/build/quarantined-test-results/testDemoDebugUnitTest/TEST-sample.results.test.multiple.bitrise.com.multipletestresultssample.UnitTest0.xml",
+			want:         "app-demoDebug-quarantined",
+		},
 	}
 
 	for _, tt := range tc {
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/affected"
+)
+
+// compiledTestClasses lists the fully qualified names of the unit test classes compiled for the given variants,
+// by the <module>-<variant> name of their test suite. Test suites without compiled test classes are left out.
+//
+// Java classes are compiled to <build dir>/intermediates/javac/<variant>/**/classes,
+// Kotlin classes to <build dir>/tmp/kotlin-classes/<variant>. Nested classes keep the '$' separated name.
+func compiledTestClasses(graph affected.Graph, projectDir string, variants gradle.Variants) (map[string][]string, error) {
+	testClasses := map[string][]string{}
+
+	for module, moduleVariants := range variants {
+		buildDir := moduleBuildDir(graph, projectDir, module)
+
+		for _, variant := range moduleVariants {
+			classes := map[string]bool{}
+			variantDir := lowerFirst(variant)
+			if err := collectClassNames(filepath.Join(buildDir, "intermediates", "javac", variantDir), true, classes); err != nil {
+				return nil, err
+			}
+			if err := collectClassNames(filepath.Join(buildDir, "tmp", "kotlin-classes", variantDir), false, classes); err != nil {
+				return nil, err
+			}
+
+			if len(classes) > 0 {
+				testClasses[moduleTestSuiteName(graph, projectDir, module, variant)] = sortedSet(classes)
+			}
+		}
+	}
+
+	return testClasses, nil
+}
+
+// testSuiteNames returns the sorted <module>-<variant> test suite names of the given variants.
+func testSuiteNames(graph affected.Graph, projectDir string, variants gradle.Variants) []string {
+	var names []string
+	for module, moduleVariants := range variants {
+		for _, variant := range moduleVariants {
+			names = append(names, moduleTestSuiteName(graph, projectDir, module, variant))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// moduleProjectDir returns the project directory of the module as reported by Gradle,
+// falling back to the conventional layout (feature:login in <project>/feature/login) if the project graph is not available.
+func moduleProjectDir(graph affected.Graph, projectDir, module string) string {
+	if dir, ok := graph.ProjectDirs[":"+module]; ok {
+		return dir
+	}
+	return filepath.Join(projectDir, filepath.FromSlash(strings.ReplaceAll(module, ":", "/")))
+}
+
+// moduleBuildDir returns the build directory of the module as reported by Gradle,
+// falling back to the build directory inside the module's project directory.
+func moduleBuildDir(graph affected.Graph, projectDir, module string) string {
+	if dir, ok := graph.BuildDirs[":"+module]; ok {
+		return dir
+	}
+	return filepath.Join(moduleProjectDir(graph, projectDir, module), "build")
+}
+
+// moduleTestSuiteName returns the <module>-<variant> test suite name of the module's unit test task (app-freeDebug),
+// where module is the name of the build directory's parent directory, as in the test addon export and the test filter init script.
+func moduleTestSuiteName(graph affected.Graph, projectDir, module, variant string) string {
+	return filepath.Base(filepath.Dir(moduleBuildDir(graph, projectDir, module))) + "-" + lowerFirst(strings.TrimSuffix(variant, "UnitTest"))
+}
+
+func collectClassNames(root string, inClassesDir bool, classes map[string]bool) error {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".class" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(strings.TrimSuffix(rel, ".class"))
+
+		// AGP places the javac output into a classes or <task>/classes subdirectory.
+		if inClassesDir {
+			i := strings.Index("/"+rel, "/classes/")
+			if i == -1 {
+				return nil
+			}
+			rel = rel[i+len("classes/"):]
+		}
+		if strings.HasPrefix(rel, "META-INF/") || strings.HasSuffix(rel, "package-info") || strings.HasSuffix(rel, "module-info") {
+			return nil
+		}
+
+		classes[strings.ReplaceAll(rel, "/", ".")] = true
+		return nil
+	})
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/bitrise-steplib/bitrise-step-android-unit-test/gradleconfig"
+)
+
+// variantDimensions is a variant split into its product flavors and build type,
+// for example FreeStagingDebugUnitTest: [free, staging] and debug.
+type variantDimensions struct {
+	Flavors   []string
+	BuildType string
+}
+
+// Flavor returns the combined product flavor name of the variant, for example freeStaging.
+func (d variantDimensions) Flavor() string {
+	flavor := ""
+	for i, f := range d.Flavors {
+		if i > 0 {
+			f = upperFirst(f)
+		}
+		flavor += f
+	}
+	return flavor
+}
+
+// parseVariantDimensions splits a unit test variant (as returned by Task.GetVariants) into its product flavors and build type.
+//
+// The build type is the longest of the module's build types (as resolved from Gradle) the variant name ends with,
+// so that multi-word build types (nonMinifiedRelease, benchmarkRelease) are not mistaken for a product flavor and a build type.
+// If the build types are unknown (for example in a non-Android module), the last camel case word is considered to be the build type.
+// The preceding camel case words are the product flavors (one per flavor dimension).
+func parseVariantDimensions(variant string, buildTypes []string) variantDimensions {
+	name := strings.TrimSuffix(variant, "UnitTest")
+	if name == "" {
+		return variantDimensions{}
+	}
+
+	buildType := ""
+	for _, candidate := range buildTypes {
+		if len(candidate) > len(buildType) && hasBuildTypeSuffix(name, candidate) {
+			buildType = candidate
+		}
+	}
+
+	var flavorWords []string
+	if buildType != "" {
+		flavorWords = splitCamelCase(name[:len(name)-len(buildType)])
+	} else {
+		words := splitCamelCase(name)
+		flavorWords, buildType = words[:len(words)-1], lowerWord(words[len(words)-1])
+	}
+
+	flavors := make([]string, 0, len(flavorWords))
+	for _, word := range flavorWords {
+		flavors = append(flavors, lowerWord(word))
+	}
+
+	return variantDimensions{Flavors: flavors, BuildType: buildType}
+}
+
+// hasBuildTypeSuffix checks if the variant name ends with the capitalized build type name (FreeNonMinifiedRelease for nonMinifiedRelease).
+func hasBuildTypeSuffix(name, buildType string) bool {
+	return buildType != "" && strings.HasSuffix(name, upperFirst(buildType))
+}
+
+// lowerWord lower cases the first letter of a camel case word, or the whole word if it is an acronym (QA).
+func lowerWord(word string) string {
+	if strings.ToUpper(word) == word {
+		return strings.ToLower(word)
+	}
+	return lowerFirst(word)
+}
+
+// variantPatterns are the build type, product flavor and exclude patterns a variant is selected by.
+type variantPatterns struct {
+	BuildTypes []string
+	Flavors    []string
+	Excluded   []string
+}
+
+func (p variantPatterns) isEmpty() bool {
+	return len(p.BuildTypes) == 0 && len(p.Flavors) == 0 && len(p.Excluded) == 0
+}
+
+// selectVariantDimensions selects the cartesian product of the build type and product flavor patterns
+// from the variants, dropping the variants matching any of the exclude patterns.
+//
+// Patterns are case-insensitive and '*' matches any sequence of characters. A product flavor pattern matches
+// either a single product flavor (free) or the combined flavor name (freeStaging). An exclude pattern matches
+// the variant name (freeStagingRelease), the build type, a single or the combined product flavor name.
+func selectVariantDimensions(patterns variantPatterns, variantsMap gradle.Variants, moduleBuildTypes map[string][]string) (gradle.Variants, error) {
+	if unresolved := unresolvedVariantCombinations(patterns, variantsMap, moduleBuildTypes); len(unresolved) > 0 {
+		buildTypes, flavors := availableVariantDimensions(variantsMap, moduleBuildTypes)
+		return nil, fmt.Errorf("no variant found for: %s\navailable build types: %s\navailable product flavors: %s",
+			strings.Join(unresolved, ", "), joinOrNone(buildTypes), joinOrNone(flavors))
+	}
+
+	selectedVariants := gradle.Variants{}
+	for module, variants := range variantsMap {
+		for _, variant := range variants {
+			dimensions := parseVariantDimensions(variant, moduleBuildTypes[module])
+
+			if !matchesBuildType(patterns.BuildTypes, dimensions) || !matchesFlavor(patterns.Flavors, dimensions) {
+				continue
+			}
+			if isVariantExcluded(patterns.Excluded, variant, dimensions) {
+				continue
+			}
+
+			selectedVariants[module] = append(selectedVariants[module], variant)
+		}
+	}
+
+	if len(selectedVariants) == 0 {
+		return nil, fmt.Errorf("every matching variant is excluded")
+	}
+
+	return selectedVariants, nil
+}
+
+// unresolvedVariantCombinations lists the build type and product flavor pattern combinations, which match no variant.
+func unresolvedVariantCombinations(patterns variantPatterns, variantsMap gradle.Variants, moduleBuildTypes map[string][]string) []string {
+	buildTypePatterns := patterns.BuildTypes
+	if len(buildTypePatterns) == 0 {
+		buildTypePatterns = []string{""}
+	}
+	flavorPatterns := patterns.Flavors
+	if len(flavorPatterns) == 0 {
+		flavorPatterns = []string{""}
+	}
+
+	var unresolved []string
+	for _, buildTypePattern := range buildTypePatterns {
+		for _, flavorPattern := range flavorPatterns {
+			if buildTypePattern == "" && flavorPattern == "" {
+				continue
+			}
+
+			if !anyVariantMatches(variantsMap, moduleBuildTypes, buildTypePattern, flavorPattern) {
+				var combination []string
+				if buildTypePattern != "" {
+					combination = append(combination, fmt.Sprintf("build type %q", buildTypePattern))
+				}
+				if flavorPattern != "" {
+					combination = append(combination, fmt.Sprintf("product flavor %q", flavorPattern))
+				}
+				unresolved = append(unresolved, strings.Join(combination, " with "))
+			}
+		}
+	}
+
+	return unresolved
+}
+
+func anyVariantMatches(variantsMap gradle.Variants, moduleBuildTypes map[string][]string, buildTypePattern, flavorPattern string) bool {
+	for module, variants := range variantsMap {
+		for _, variant := range variants {
+			dimensions := parseVariantDimensions(variant, moduleBuildTypes[module])
+			if (buildTypePattern == "" || matchesBuildType([]string{buildTypePattern}, dimensions)) &&
+				(flavorPattern == "" || matchesFlavor([]string{flavorPattern}, dimensions)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesBuildType(patterns []string, dimensions variantDimensions) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if gradleconfig.GlobRegexp(pattern, true).MatchString(dimensions.BuildType) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesFlavor(patterns []string, dimensions variantDimensions) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		re := gradleconfig.GlobRegexp(pattern, true)
+		if len(dimensions.Flavors) > 0 && re.MatchString(dimensions.Flavor()) {
+			return true
+		}
+		for _, flavor := range dimensions.Flavors {
+			if re.MatchString(flavor) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isVariantExcluded(patterns []string, variant string, dimensions variantDimensions) bool {
+	names := append([]string{lowerFirst(strings.TrimSuffix(variant, "UnitTest"))}, dimensions.Flavors...)
+	if dimensions.BuildType != "" {
+		names = append(names, dimensions.BuildType)
+	}
+	if len(dimensions.Flavors) > 1 {
+		names = append(names, dimensions.Flavor())
+	}
+
+	for _, pattern := range patterns {
+		re := gradleconfig.GlobRegexp(pattern, true)
+		for _, name := range names {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func availableVariantDimensions(variantsMap gradle.Variants, moduleBuildTypes map[string][]string) ([]string, []string) {
+	buildTypes := map[string]bool{}
+	flavors := map[string]bool{}
+	for module, variants := range variantsMap {
+		for _, variant := range variants {
+			dimensions := parseVariantDimensions(variant, moduleBuildTypes[module])
+			if dimensions.BuildType != "" {
+				buildTypes[dimensions.BuildType] = true
+			}
+			for _, flavor := range dimensions.Flavors {
+				flavors[flavor] = true
+			}
+		}
+	}
+	return sortedSet(buildTypes), sortedSet(flavors)
+}
+
+// splitCamelCase splits the name into its camel case words, keeping acronyms together: QADebug is split into QA and Debug.
+func splitCamelCase(s string) []string {
+	var words []string
+	start := 0
+	runes := []rune(s)
+	for i := 1; i < len(runes); i++ {
+		startsWord := unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1])
+		// The last capital of an acronym starts the next word, if it is followed by a lowercase letter.
+		endsAcronym := unicode.IsUpper(runes[i]) && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if startsWord || endsAcronym {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+func lowerFirst(s string) string {
+	for i, r := range s {
+		return string(unicode.ToLower(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
+
+func upperFirst(s string) string {
+	for i, r := range s {
+		return string(unicode.ToUpper(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
+
+func sortedSet(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bitrise-io/go-android/v2/gradle"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseVariantDimensions(t *testing.T) {
+	buildTypes := []string{"debug", "release", "nonMinifiedRelease", "benchmarkRelease", "QA"}
+
+	tests := []struct {
+		variant    string
+		buildTypes []string
+		want       variantDimensions
+	}{
+		{variant: "DebugUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{}, BuildType: "debug"}},
+		{variant: "FreeDebugUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{"free"}, BuildType: "debug"}},
+		{variant: "FreeStagingReleaseUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{"free", "staging"}, BuildType: "release"}},
+		{variant: "Qa2DebugUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{"qa2"}, BuildType: "debug"}},
+		{variant: "NonMinifiedReleaseUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{}, BuildType: "nonMinifiedRelease"}},
+		{variant: "FreeBenchmarkReleaseUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{"free"}, BuildType: "benchmarkRelease"}},
+		{variant: "FreeQAUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{"free"}, BuildType: "QA"}},
+		{variant: "SITStagingDebugUnitTest", buildTypes: buildTypes, want: variantDimensions{Flavors: []string{"sit", "staging"}, BuildType: "debug"}},
+		// Without the build types of the module, the last word is considered to be the build type.
+		{variant: "FreeStagingReleaseUnitTest", want: variantDimensions{Flavors: []string{"free", "staging"}, BuildType: "release"}},
+		{variant: "FreeQAUnitTest", want: variantDimensions{Flavors: []string{"free"}, BuildType: "qa"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.variant, func(t *testing.T) {
+			got := parseVariantDimensions(tt.variant, tt.buildTypes)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	require.Equal(t, "freeStaging", parseVariantDimensions("FreeStagingReleaseUnitTest", buildTypes).Flavor())
+}
+
+func Test_selectVariantDimensions(t *testing.T) {
+	variantsMap := gradle.Variants{
+		"app": {
+			"FreeStagingDebugUnitTest", "FreeStagingReleaseUnitTest", "FreeProdDebugUnitTest", "FreeProdReleaseUnitTest",
+			"PaidStagingDebugUnitTest", "PaidStagingReleaseUnitTest", "PaidProdDebugUnitTest", "PaidProdReleaseUnitTest",
+		},
+		"lib": {"DebugUnitTest", "ReleaseUnitTest", "NonMinifiedReleaseUnitTest"},
+	}
+	moduleBuildTypes := map[string][]string{
+		"app": {"debug", "release"},
+		"lib": {"debug", "release", "nonMinifiedRelease"},
+	}
+
+	tests := []struct {
+		name     string
+		patterns variantPatterns
+		want     gradle.Variants
+		wantErr  string
+	}{
+		{
+			name:     "Build types",
+			patterns: variantPatterns{BuildTypes: []string{"Debug"}},
+			want: gradle.Variants{
+				"app": {"FreeStagingDebugUnitTest", "FreeProdDebugUnitTest", "PaidStagingDebugUnitTest", "PaidProdDebugUnitTest"},
+				"lib": {"DebugUnitTest"},
+			},
+		},
+		{
+			name:     "Cartesian product of build types and product flavors",
+			patterns: variantPatterns{BuildTypes: []string{"debug"}, Flavors: []string{"free", "paidProd"}},
+			want: gradle.Variants{
+				"app": {"FreeStagingDebugUnitTest", "FreeProdDebugUnitTest", "PaidProdDebugUnitTest"},
+			},
+		},
+		{
+			name:     "Wildcards and exclusions",
+			patterns: variantPatterns{Flavors: []string{"*Staging"}, Excluded: []string{"release", "paid*"}},
+			want: gradle.Variants{
+				"app": {"FreeStagingDebugUnitTest"},
+			},
+		},
+		{
+			name:     "Exclusions only",
+			patterns: variantPatterns{Excluded: []string{"release"}},
+			want: gradle.Variants{
+				"app": {"FreeStagingDebugUnitTest", "FreeProdDebugUnitTest", "PaidStagingDebugUnitTest", "PaidProdDebugUnitTest"},
+				"lib": {"DebugUnitTest", "NonMinifiedReleaseUnitTest"},
+			},
+		},
+		{
+			name:     "Multi-word build types",
+			patterns: variantPatterns{BuildTypes: []string{"nonMinified*"}},
+			want: gradle.Variants{
+				"lib": {"NonMinifiedReleaseUnitTest"},
+			},
+		},
+		{
+			name:     "Unresolvable combinations",
+			patterns: variantPatterns{BuildTypes: []string{"debug", "beta"}, Flavors: []string{"free", "demo"}},
+			wantErr: `no variant found for: build type "debug" with product flavor "demo", build type "beta" with product flavor "free", build type "beta" with product flavor "demo"
+available build types: debug, nonMinifiedRelease, release
+available product flavors: free, paid, prod, staging`,
+		},
+		{
+			name:     "Everything excluded",
+			patterns: variantPatterns{BuildTypes: []string{"release"}, Excluded: []string{"release"}},
+			wantErr:  "every matching variant is excluded",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectVariantDimensions(tt.patterns, variantsMap, moduleBuildTypes)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}